@@ -1,36 +1,644 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
+var ErrNoAvailableEndpoint = errors.New("no available rpc endpoint")
+
+type ClientOptions struct {
+	NodeUrls           []string      // 节点地址列表
+	MaxHeadLag         uint64        // 落后已知最高区块超过该数量的节点会被标记为 stale
+	ProbeInterval      time.Duration // 节点健康探测间隔
+	ProbeTimeout       time.Duration // 单次探测的超时时间
+	ReconnectBaseDelay time.Duration // 断线重连的初始等待时间，之后指数增长
+	ReconnectMaxDelay  time.Duration // 断线重连的最大等待时间
+	Timeouts           RequestTimeouts
+	RateLimit          *RateLimitOptions  // 为 nil 时不限流
+	Headers            http.Header        // 每个请求都会带上的请求头
+	JWTSecretFile      string             // geth authrpc 使用的 jwt 密钥文件
+	MaxBatchSize       int                // 单个批量请求的最大长度，超过后自动切分
+	BatchConcurrency   int                // 切分后的批量请求最多同时发送几个
+	CoalesceWindow     time.Duration      // 大于 0 时，该时间窗口内的并发单个请求会被合并成批量请求
+	Cache              *CacheOptions      // 不可变数据的响应缓存，为 nil 时不缓存
+	Fixture            *FixtureOptions    // 录制/回放 rpc 请求，用于离线测试
+	FeeOracle          *FeeOracleOptions  // 手续费估算参数，为 nil 时使用默认值
+	Simulation         *SimulationOptions // 发送交易前的预执行参数，为 nil 时使用默认值
+	Multicall          *MulticallOptions  // 不为 nil 时代币查询通过 Multicall3 聚合，没有部署时退回到批量请求
+	ENS                *ENSOptions        // ENS 解析参数，为 nil 时使用默认值
+}
+
+// ConnState 客户端整体的连接状态，只要有一个节点可用就是 StateConnected
+type ConnState int
+
+const (
+	StateConnected ConnState = iota
+	StateReconnecting
+	StateClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+type rpcEndpoint struct {
+	url       string        // 已去掉 basic auth 账号信息
+	headers   http.Header   // 该节点专用的请求头，如 url 中的 basic auth
+	client    *rpc.Client   // 为 nil 时表示连接已断开，正在重连
+	latency   time.Duration // 平滑后的请求延迟
+	errorRate float64       // 平滑后的错误率，0 ~ 1
+	head      uint64        // 最近一次探测到的区块高度
+	stale     bool          // 区块高度落后过多
+	pausedAt  time.Time     // 收到 429 后，在该时间之前尽量不使用这个节点
+}
+
 type ETHRPCClient struct {
-	NodeUrl string
-	client  *rpc.Client
+	options   *ClientOptions
+	endpoints []*rpcEndpoint
+	lock      sync.Mutex
+	probeLock sync.Mutex // 同一时间只进行一次探测
+	state     ConnState
+	connected chan struct{} // 恢复连接时关闭，用于 WaitConnected
+	closed    chan struct{}
+	limiter   *RateLimiter
+	jwtSecret []byte
+	coalescer *callCoalescer
+	fixture   *FixtureStore
+}
+
+func NewETHRPCClient(nodeUrls ...string) (*ETHRPCClient, error) {
+	return NewETHRPCClientWithOptions(&ClientOptions{NodeUrls: nodeUrls})
 }
 
-func NewETHRPCClient(nodeUrl string) *ETHRPCClient {
+func NewETHRPCClientWithOptions(options *ClientOptions) (*ETHRPCClient, error) {
+	if len(options.NodeUrls) == 0 {
+		return nil, errors.New("初始化 rpcCLient 失败，没有配置节点地址")
+	}
+	if options.MaxHeadLag == 0 {
+		options.MaxHeadLag = 5
+	}
+	if options.ProbeInterval == 0 {
+		options.ProbeInterval = 30 * time.Second
+	}
+	if options.ProbeTimeout == 0 {
+		options.ProbeTimeout = 5 * time.Second
+	}
+	if options.ReconnectBaseDelay == 0 {
+		options.ReconnectBaseDelay = 500 * time.Millisecond
+	}
+	if options.ReconnectMaxDelay == 0 {
+		options.ReconnectMaxDelay = 30 * time.Second
+	}
+	if options.MaxBatchSize == 0 {
+		options.MaxBatchSize = 100
+	}
+	if options.BatchConcurrency == 0 {
+		options.BatchConcurrency = 4
+	}
 	client := &ETHRPCClient{
-		NodeUrl: nodeUrl,
+		options:   options,
+		lock:      sync.Mutex{},
+		state:     StateConnected,
+		connected: make(chan struct{}),
+		closed:    make(chan struct{}),
+	}
+	close(client.connected)
+	if options.RateLimit != nil {
+		client.limiter = NewRateLimiter(options.RateLimit)
+	}
+	if options.CoalesceWindow > 0 {
+		client.coalescer = newCallCoalescer(client)
+	}
+	if options.Fixture != nil {
+		fixture, err := NewFixtureStore(options.Fixture)
+		if err != nil {
+			return nil, err
+		}
+		client.fixture = fixture
+	}
+	if options.JWTSecretFile != "" {
+		secret, err := readJWTSecret(options.JWTSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		client.jwtSecret = secret
+	}
+	for _, nodeUrl := range options.NodeUrls {
+		endpointUrl, headers := splitBasicAuth(nodeUrl)
+		client.endpoints = append(client.endpoints, &rpcEndpoint{url: endpointUrl, headers: headers})
+	}
+	if err := client.initRpc(); err != nil {
+		return nil, err
+	}
+	if len(client.endpoints) > 1 {
+		go client.probeLoop()
+	}
+	return client, nil
+}
+
+// initRpc 至少要有一个节点能连上，连不上的节点转入后台重连
+func (erc *ETHRPCClient) initRpc() error {
+	var lastErr error
+	for _, e := range erc.endpoints {
+		rpcClient, err := erc.dial(e)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		e.client = rpcClient
+	}
+	if len(erc.ranked()) == 0 {
+		return fmt.Errorf("初始化 rpcCLient 失败%s", lastErr.Error())
+	}
+	for _, e := range erc.endpoints {
+		if e.client == nil {
+			go erc.reconnect(e)
+		}
+	}
+	return nil
+}
+
+// GetRpc 返回当前评分最好的节点连接
+func (erc *ETHRPCClient) GetRpc() (*rpc.Client, error) {
+	ranked := erc.ranked()
+	if len(ranked) == 0 {
+		return nil, ErrNoAvailableEndpoint
+	}
+	return erc.clientOf(ranked[0]), nil
+}
+
+// SupportsSubscriptions 只有 ws/wss 和 IPC 连接才支持 eth_subscribe
+func (erc *ETHRPCClient) SupportsSubscriptions() bool {
+	client, err := erc.GetRpc()
+	if err != nil {
+		return false
+	}
+	return client.SupportsSubscriptions()
+}
+
+func (erc *ETHRPCClient) State() ConnState {
+	erc.lock.Lock()
+	defer erc.lock.Unlock()
+	return erc.state
+}
+
+// WaitConnected 阻塞直到至少有一个节点恢复连接
+func (erc *ETHRPCClient) WaitConnected(ctx context.Context) error {
+	erc.lock.Lock()
+	connected := erc.connected
+	erc.lock.Unlock()
+	select {
+	case <-connected:
+		return nil
+	case <-erc.closed:
+		return errors.New("rpc client is closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (erc *ETHRPCClient) Close() {
+	erc.lock.Lock()
+	defer erc.lock.Unlock()
+	if erc.state == StateClosed {
+		return
+	}
+	erc.state = StateClosed
+	close(erc.closed)
+	for _, e := range erc.endpoints {
+		if e.client != nil {
+			e.client.Close()
+			e.client = nil
+		}
+	}
+}
+
+func (erc *ETHRPCClient) Call(result interface{}, method string, args ...interface{}) error {
+	return erc.CallContext(context.Background(), result, method, args...)
+}
+
+func (erc *ETHRPCClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	cost := erc.cost(method)
+	if erc.limiter != nil {
+		if err := erc.limiter.Wait(ctx, cost); err != nil {
+			return err
+		}
+	}
+	if erc.coalescer != nil {
+		return erc.coalescer.call(ctx, result, method, args...)
+	}
+	return erc.do(ctx, cost, func(client *rpc.Client) error {
+		return client.CallContext(ctx, result, method, args...)
+	})
+}
+
+func (erc *ETHRPCClient) BatchCall(reqs []rpc.BatchElem) error {
+	return erc.BatchCallContext(context.Background(), reqs)
+}
+
+func (erc *ETHRPCClient) BatchCallContext(ctx context.Context, reqs []rpc.BatchElem) error {
+	if erc.limiter != nil {
+		if err := erc.limiter.Wait(ctx, erc.batchCost(reqs)); err != nil {
+			return err
+		}
+	}
+	return erc.dispatchBatch(ctx, reqs)
+}
+
+// cost 请求消耗的额度，没有配置限流时为 0
+func (erc *ETHRPCClient) cost(method string) float64 {
+	if erc.limiter == nil {
+		return 0
+	}
+	return erc.limiter.Cost(method)
+}
+
+func (erc *ETHRPCClient) batchCost(reqs []rpc.BatchElem) float64 {
+	cost := 0.0
+	for _, req := range reqs {
+		cost += erc.cost(req.Method)
 	}
-	client.initRpc()
-	return client
+	return cost
 }
 
-func (erc *ETHRPCClient) initRpc() {
-	rpcClient, err := rpc.DialHTTP(erc.NodeUrl)
+// RemainingBudget 当前周期剩余的请求额度，没有配置预算时第二个返回值为 false
+func (erc *ETHRPCClient) RemainingBudget() (float64, bool) {
+	if erc.limiter == nil {
+		return 0, false
+	}
+	return erc.limiter.RemainingBudget()
+}
+
+// do 所有节点都返回 429 时，等到最早的 Retry-After 之后再重试，最多重试 3 轮。
+// 节点没有返回 Retry-After 时至少等待 ReconnectBaseDelay；每轮重试都是新的请求，按 cost 计入限流和额度
+func (erc *ETHRPCClient) do(ctx context.Context, cost float64, fn func(client *rpc.Client) error) error {
+	for round := 0; ; round++ {
+		err := erc.tryEndpoints(ctx, fn)
+		if !isTooManyRequests(err) || round == 3 {
+			return err
+		}
+		wait := erc.earliestResume()
+		if wait <= 0 {
+			wait = erc.options.ReconnectBaseDelay
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+		if erc.limiter != nil {
+			if err := erc.limiter.Wait(ctx, cost); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// tryEndpoints 按评分从高到低依次尝试各个节点，遇到传输层错误时切换到下一个节点
+func (erc *ETHRPCClient) tryEndpoints(ctx context.Context, fn func(client *rpc.Client) error) error {
+	ranked := erc.ranked()
+	if len(ranked) == 0 {
+		return ErrNoAvailableEndpoint
+	}
+	var err error
+	for _, e := range ranked {
+		client := erc.clientOf(e)
+		if client == nil {
+			err = ErrNoAvailableEndpoint
+			continue
+		}
+		start := time.Now()
+		err = fn(client)
+		if err != nil && ctx.Err() != nil {
+			// 调用方取消或超时，不是节点的问题
+			return err
+		}
+		erc.record(e, time.Since(start), err)
+		if err == nil || !shouldFailover(err) {
+			return err
+		}
+		if isTransportError(err) {
+			erc.disconnect(e, client)
+		}
+	}
+	return err
+}
+
+// earliestResume 距离最早一个被暂停的节点恢复还要等多久，没有被暂停的节点时返回 0
+func (erc *ETHRPCClient) earliestResume() time.Duration {
+	erc.lock.Lock()
+	defer erc.lock.Unlock()
+	var earliest time.Time
+	for _, e := range erc.endpoints {
+		if e.client == nil || e.pausedAt.IsZero() {
+			continue
+		}
+		if earliest.IsZero() || e.pausedAt.Before(earliest) {
+			earliest = e.pausedAt
+		}
+	}
+	if wait := time.Until(earliest); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+func (erc *ETHRPCClient) dial(e *rpcEndpoint) (*rpc.Client, error) {
+	base := http.DefaultTransport
+	if erc.fixture != nil {
+		base = erc.fixture.transport(base)
+	}
+	httpClient := &http.Client{
+		Transport: &retryAfterTransport{
+			base: base,
+			onRetryAfter: func(d time.Duration) {
+				erc.lock.Lock()
+				defer erc.lock.Unlock()
+				e.pausedAt = time.Now().Add(d)
+			},
+		},
+	}
+	options := []rpc.ClientOption{rpc.WithHTTPClient(httpClient)}
+	if len(erc.options.Headers) > 0 {
+		options = append(options, rpc.WithHeaders(erc.options.Headers))
+	}
+	if len(e.headers) > 0 {
+		options = append(options, rpc.WithHeaders(e.headers))
+	}
+	if erc.jwtSecret != nil {
+		options = append(options, rpc.WithHTTPAuth(newJWTAuth(erc.jwtSecret)))
+	}
+	return dialRpc(e.url, options...)
+}
+
+// disconnect 连接已经不可用，摘掉该节点并在后台重连
+func (erc *ETHRPCClient) disconnect(e *rpcEndpoint, client *rpc.Client) {
+	erc.lock.Lock()
+	if e.client != client || erc.state == StateClosed {
+		erc.lock.Unlock()
+		return
+	}
+	e.client = nil
+	erc.updateStateLocked()
+	erc.lock.Unlock()
+	client.Close()
+	go erc.reconnect(e)
+}
+
+// reconnect 带随机抖动的指数退避重连，重连成功后还要通过一次 eth_blockNumber 检查
+func (erc *ETHRPCClient) reconnect(e *rpcEndpoint) {
+	delay := erc.options.ReconnectBaseDelay
+	for {
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+		select {
+		case <-erc.closed:
+			return
+		case <-time.After(wait):
+		}
+		if client, err := erc.dialAndCheck(e); err == nil {
+			erc.lock.Lock()
+			if erc.state == StateClosed {
+				erc.lock.Unlock()
+				client.Close()
+				return
+			}
+			e.client = client
+			e.errorRate = 0
+			erc.updateStateLocked()
+			erc.lock.Unlock()
+			return
+		}
+		delay *= 2
+		if delay > erc.options.ReconnectMaxDelay {
+			delay = erc.options.ReconnectMaxDelay
+		}
+	}
+}
+
+func (erc *ETHRPCClient) dialAndCheck(e *rpcEndpoint) (*rpc.Client, error) {
+	client, err := erc.dial(e)
 	if err != nil {
-		errInfo := fmt.Errorf("初始化 rpcCLient 失败%s", err.Error()).Error()
-		panic(errInfo)
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), erc.options.ProbeTimeout)
+	defer cancel()
+	number := ""
+	if err := client.CallContext(ctx, &number, "eth_blockNumber"); err != nil {
+		client.Close()
+		return nil, err
 	}
-	erc.client = rpcClient
+	return client, nil
 }
 
-func (erc *ETHRPCClient) GetRpc() *rpc.Client {
-	if erc.client == nil {
-		erc.initRpc()
+func (erc *ETHRPCClient) updateStateLocked() {
+	if erc.state == StateClosed {
+		return
+	}
+	alive := false
+	for _, e := range erc.endpoints {
+		if e.client != nil {
+			alive = true
+			break
+		}
+	}
+	switch {
+	case alive && erc.state == StateReconnecting:
+		erc.state = StateConnected
+		close(erc.connected)
+	case !alive && erc.state == StateConnected:
+		erc.state = StateReconnecting
+		erc.connected = make(chan struct{})
+	}
+}
+
+func (erc *ETHRPCClient) clientOf(e *rpcEndpoint) *rpc.Client {
+	erc.lock.Lock()
+	defer erc.lock.Unlock()
+	return e.client
+}
+
+// Probe 用 eth_blockNumber 探测所有节点的延迟和区块高度，并标记落后过多的节点。
+// 配置了多个节点时客户端会在后台按 ProbeInterval 定时探测，一般不需要手动调用
+func (erc *ETHRPCClient) Probe() {
+	erc.probeLock.Lock()
+	defer erc.probeLock.Unlock()
+
+	var wg sync.WaitGroup
+	for _, e := range erc.ranked() {
+		client := erc.clientOf(e)
+		if client == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(e *rpcEndpoint, client *rpc.Client) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), erc.options.ProbeTimeout)
+			defer cancel()
+			number := ""
+			start := time.Now()
+			err := client.CallContext(ctx, &number, "eth_blockNumber")
+			erc.record(e, time.Since(start), err)
+			if err != nil || len(number) < 3 {
+				if err != nil && isTransportError(err) {
+					erc.disconnect(e, client)
+				}
+				return
+			}
+			head, ok := new(big.Int).SetString(number[2:], 16)
+			if !ok {
+				return
+			}
+			erc.lock.Lock()
+			e.head = head.Uint64()
+			erc.lock.Unlock()
+		}(e, client)
+	}
+	wg.Wait()
+
+	erc.lock.Lock()
+	defer erc.lock.Unlock()
+	bestHead := uint64(0)
+	for _, e := range erc.endpoints {
+		if e.head > bestHead {
+			bestHead = e.head
+		}
+	}
+	for _, e := range erc.endpoints {
+		e.stale = bestHead-e.head > erc.options.MaxHeadLag
+	}
+}
+
+// probeLoop 启动后立即探测一次，之后按 ProbeInterval 定时探测，Close 之后退出
+func (erc *ETHRPCClient) probeLoop() {
+	ticker := time.NewTicker(erc.options.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		erc.Probe()
+		select {
+		case <-ticker.C:
+		case <-erc.closed:
+			return
+		}
+	}
+}
+
+func (erc *ETHRPCClient) record(e *rpcEndpoint, latency time.Duration, err error) {
+	erc.lock.Lock()
+	defer erc.lock.Unlock()
+	failed := 0.0
+	if err != nil && shouldFailover(err) {
+		failed = 1
+	}
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = (e.latency*4 + latency) / 5
+	}
+	e.errorRate = e.errorRate*0.8 + failed*0.2
+}
+
+// ranked 返回已连接的节点，未被 429 限流、非 stale 的优先，其次按评分排序
+func (erc *ETHRPCClient) ranked() []*rpcEndpoint {
+	erc.lock.Lock()
+	defer erc.lock.Unlock()
+	bestHead := uint64(0)
+	var res []*rpcEndpoint
+	for _, e := range erc.endpoints {
+		if e.client == nil {
+			continue
+		}
+		if e.head > bestHead {
+			bestHead = e.head
+		}
+		res = append(res, e)
+	}
+	score := func(e *rpcEndpoint) float64 {
+		return float64(e.latency.Milliseconds()) + e.errorRate*1000 + float64(bestHead-e.head)*100
+	}
+	now := time.Now()
+	sort.SliceStable(res, func(i, j int) bool {
+		pausedI, pausedJ := res[i].pausedAt.After(now), res[j].pausedAt.After(now)
+		if pausedI != pausedJ {
+			return !pausedI
+		}
+		if res[i].stale != res[j].stale {
+			return !res[i].stale
+		}
+		return score(res[i]) < score(res[j])
+	})
+	return res
+}
+
+// shouldFailover 节点正常返回的 JSON-RPC 错误（如 execution reverted）换节点也没有意义
+func shouldFailover(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.ErrorCode() {
+		case -32601, -32005: // method not found, limit exceeded
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+func isTooManyRequests(err error) bool {
+	var httpErr rpc.HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests
+}
+
+// isTransportError 连接层面的错误：网络错误、连接被重置或拒绝、连接意外关闭。
+// HTTP 状态码错误说明连接本身是通的，JSON 解析失败等也不是节点不可用
+func isTransportError(err error) bool {
+	if err == nil {
+		return false
+	}
+	// http.Client 返回的错误都包装成 *url.Error，它本身实现了 net.Error，需要看里面的错误
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, rpc.ErrClientQuit)
+}
+
+// dialRpc 根据 url 的 scheme 选择传输方式：http/https、ws/wss，没有 scheme 的视为 IPC 文件路径
+func dialRpc(nodeUrl string, options ...rpc.ClientOption) (*rpc.Client, error) {
+	u, err := url.Parse(nodeUrl)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "http", "https", "ws", "wss", "":
+		return rpc.DialOptions(context.Background(), nodeUrl, options...)
+	default:
+		return nil, fmt.Errorf("unsupported rpc url scheme %q", u.Scheme)
 	}
-	return erc.client
 }
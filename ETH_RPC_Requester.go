@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"eth-relay/model"
 	"eth-relay/tool"
 	"fmt"
 	"math/big"
+	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
@@ -18,19 +21,100 @@ import (
 type ETHRPCRequester struct {
 	nonceManager *NonceManager
 	client       *ETHRPCClient
+	timeouts     RequestTimeouts
+	cache        *ResponseCache // 为 nil 时不缓存
+	finalized    *finalizedTracker
+	chain        *chainInfo
+	capabilities *nodeCapabilities
+	feeOptions   FeeOracleOptions
+	simulation   SimulationOptions
+	tokens       *tokenCache
+	multicaller  *multicaller
+	ens          *ensResolver
 }
 
 type ERC20BalanceRpcReq struct {
 	ContractAddress string // 合约的以太坊地址
 	UserAddress     string // 用户的以太坊地址
-	ContractDecimal int    // 合约所对应代币的数位
+	ContractDecimal int    // 合约没有实现 decimals 时使用的数位，正常情况下使用合约返回的 decimals
 }
 
-func NewETHRPCRequester(nodeUrl string) *ETHRPCRequester {
+// BatchResult 批量请求中单个元素的结果，与输入按下标一一对应
+type BatchResult[T any] struct {
+	Value T
+	Err   error
+}
+
+// RequestTimeouts 调用方传入的 ctx 没有设置 deadline 时，各类请求使用的默认超时
+type RequestTimeouts struct {
+	Read      time.Duration // 单个读取请求
+	BatchRead time.Duration // 批量读取请求
+	Broadcast time.Duration // 广播交易
+}
+
+func NewETHRPCRequester(nodeUrls ...string) (*ETHRPCRequester, error) {
+	return NewETHRPCRequesterWithOptions(&ClientOptions{NodeUrls: nodeUrls})
+}
+
+func NewETHRPCRequesterWithOptions(options *ClientOptions) (*ETHRPCRequester, error) {
+	client, err := NewETHRPCClientWithOptions(options)
+	if err != nil {
+		return nil, err
+	}
 	requester := &ETHRPCRequester{}
-	requester.client = NewETHRPCClient(nodeUrl)
+	requester.client = client
 	requester.nonceManager = NewNonceManager()
-	return requester
+	requester.chain = &chainInfo{lock: sync.Mutex{}}
+	requester.capabilities = &nodeCapabilities{lock: sync.Mutex{}, probed: make(map[string]bool), unsupported: make(map[string]bool)}
+	requester.tokens = &tokenCache{
+		lock:      sync.Mutex{},
+		tokens:    make(map[common.Address]TokenMetadata),
+		standards: make(map[common.Address]TokenStandard),
+	}
+	requester.multicaller = newMulticaller(options.Multicall)
+	requester.ens = newENSResolver(options.ENS)
+	requester.timeouts = options.Timeouts
+	requester.feeOptions = defaultFeeOracleOptions(options.FeeOracle)
+	if options.Simulation != nil {
+		requester.simulation = *options.Simulation
+	}
+	if requester.simulation.GasMargin == 0 {
+		requester.simulation.GasMargin = 0.2
+	}
+	if options.Cache != nil {
+		requester.cache = NewResponseCache(options.Cache)
+		requester.finalized = &finalizedTracker{lock: sync.Mutex{}}
+	}
+	if requester.timeouts.Read == 0 {
+		requester.timeouts.Read = 10 * time.Second
+	}
+	if requester.timeouts.BatchRead == 0 {
+		requester.timeouts.BatchRead = 30 * time.Second
+	}
+	if requester.timeouts.Broadcast == 0 {
+		requester.timeouts.Broadcast = 15 * time.Second
+	}
+	return requester, nil
+}
+
+// RemainingBudget 当前周期剩余的请求额度，没有配置预算时第二个返回值为 false
+func (r *ETHRPCRequester) RemainingBudget() (float64, bool) {
+	return r.client.RemainingBudget()
+}
+
+// CacheStats 没有开启缓存时返回零值
+func (r *ETHRPCRequester) CacheStats() CacheStats {
+	if r.cache == nil {
+		return CacheStats{}
+	}
+	return r.cache.Stats()
+}
+
+// InvalidateBlock 区块回滚后清除该区块相关的缓存
+func (r *ETHRPCRequester) InvalidateBlock(blockHash string) {
+	if r.cache != nil {
+		r.cache.InvalidateBlock(blockHash)
+	}
 }
 
 func NewETHWalletRequester() *ETHRPCRequester {
@@ -39,18 +123,42 @@ func NewETHWalletRequester() *ETHRPCRequester {
 }
 
 func (r *ETHRPCRequester) GetTransactionByHash(txHash string) (model.Transaction, error) {
+	return r.GetTransactionByHashContext(context.Background(), txHash)
+}
+
+func (r *ETHRPCRequester) GetTransactionByHashContext(ctx context.Context, txHash string) (model.Transaction, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
 	name := "eth_getTransactionByHash"
 	res := model.Transaction{}
-	err := r.client.GetRpc().Call(&res, name, txHash)
+	if r.cache != nil && r.cache.Get(txKey(txHash), &res) {
+		return res, nil
+	}
+	err := r.client.CallContext(ctx, &res, name, txHash)
+	if err == nil {
+		r.cacheTransaction(ctx, &res)
+	}
 	return res, err
 }
 
-func (r *ETHRPCRequester) GetTransactions(txHashArr []string) ([]*model.Transaction, error) {
+func (r *ETHRPCRequester) GetTransactions(txHashArr []string) ([]BatchResult[*model.Transaction], error) {
+	return r.GetTransactionsContext(context.Background(), txHashArr)
+}
+
+func (r *ETHRPCRequester) GetTransactionsContext(ctx context.Context, txHashArr []string) ([]BatchResult[*model.Transaction], error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
 	name := "eth_getTransactionByHash"
+	finalRes := make([]BatchResult[*model.Transaction], len(txHashArr))
 	var resArr []*model.Transaction
 	var reqs []rpc.BatchElem
-	for _, txHash := range txHashArr {
+	var indexes []int // reqs 中每个请求对应 txHashArr 的下标
+	for i, txHash := range txHashArr {
 		res := model.Transaction{}
+		if r.cache != nil && r.cache.Get(txKey(txHash), &res) {
+			finalRes[i].Value = &res
+			continue
+		}
 		req := rpc.BatchElem{
 			Method: name,
 			Args:   []interface{}{txHash},
@@ -58,15 +166,59 @@ func (r *ETHRPCRequester) GetTransactions(txHashArr []string) ([]*model.Transact
 		}
 		reqs = append(reqs, req)
 		resArr = append(resArr, &res)
+		indexes = append(indexes, i)
+	}
+	if len(reqs) == 0 {
+		return finalRes, nil
 	}
-	err := r.client.GetRpc().BatchCall(reqs)
-	return resArr, err
+	err := r.client.BatchCallContext(ctx, reqs)
+	if err != nil {
+		return nil, err
+	}
+	for j, req := range reqs {
+		i := indexes[j]
+		switch {
+		case req.Error != nil:
+			finalRes[i].Err = req.Error
+		case resArr[j].Hash == "":
+			finalRes[i].Err = fmt.Errorf("transaction %s not found", txHashArr[i])
+		default:
+			finalRes[i].Value = resArr[j]
+			r.cacheTransaction(ctx, resArr[j])
+		}
+	}
+	return finalRes, nil
 }
 
 func (r *ETHRPCRequester) GetETHBalance(address string) (string, error) {
+	return r.GetETHBalanceContext(context.Background(), address)
+}
+
+func (r *ETHRPCRequester) GetETHBalanceContext(ctx context.Context, address string) (string, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.getETHBalance(ctx, address, "latest")
+}
+
+// GetETHBalanceAt 读取指定区块的余额，同时返回实际读取的区块
+func (r *ETHRPCRequester) GetETHBalanceAt(ctx context.Context, address string, block BlockSelector) (string, BlockRef, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	ref, param, err := r.resolveBlock(ctx, block)
+	if err != nil {
+		return "", BlockRef{}, err
+	}
+	balance, err := r.getETHBalance(ctx, address, param)
+	return balance, ref, err
+}
+
+func (r *ETHRPCRequester) getETHBalance(ctx context.Context, address string, block interface{}) (string, error) {
+	if err := r.resolveAddressArgs(ctx, &address); err != nil {
+		return "", err
+	}
 	name := "eth_getBalance"
 	res := ""
-	err := r.client.GetRpc().Call(&res, name, address, "latest")
+	err := r.client.CallContext(ctx, &res, name, address, block)
 	if err != nil {
 		return "", err
 	}
@@ -74,81 +226,115 @@ func (r *ETHRPCRequester) GetETHBalance(address string) (string, error) {
 	return ten.String(), nil
 }
 
-func (r *ETHRPCRequester) GetEthBalances(addressArr []string) ([]string, error) {
+func (r *ETHRPCRequester) GetEthBalances(addressArr []string) ([]BatchResult[string], error) {
+	return r.GetEthBalancesContext(context.Background(), addressArr)
+}
+
+func (r *ETHRPCRequester) GetEthBalancesContext(ctx context.Context, addressArr []string) ([]BatchResult[string], error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	return r.getEthBalances(ctx, addressArr, "latest")
+}
+
+func (r *ETHRPCRequester) GetEthBalancesAt(ctx context.Context, addressArr []string, block BlockSelector) ([]BatchResult[string], BlockRef, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	ref, param, err := r.resolveBlock(ctx, block)
+	if err != nil {
+		return nil, BlockRef{}, err
+	}
+	res, err := r.getEthBalances(ctx, addressArr, param)
+	return res, ref, err
+}
+
+func (r *ETHRPCRequester) getEthBalances(ctx context.Context, addressArr []string, block interface{}) ([]BatchResult[string], error) {
 	name := "eth_getBalance"
+	finalRes := make([]BatchResult[string], len(addressArr))
 	var resArr []*string
 	var reqs []rpc.BatchElem
-	for _, addr := range addressArr {
+	var indexes []int // reqs 中每个请求对应 addressArr 的下标
+	for i, addr := range addressArr {
+		if err := r.resolveAddressArgs(ctx, &addr); err != nil {
+			finalRes[i].Err = err
+			continue
+		}
 		res := ""
 		req := rpc.BatchElem{
 			Method: name,
-			Args:   []interface{}{addr, "latest"},
+			Args:   []interface{}{addr, block},
 			Result: &res,
 		}
 		reqs = append(reqs, req)
 		resArr = append(resArr, &res)
+		indexes = append(indexes, i)
+	}
+	if len(reqs) == 0 {
+		return finalRes, nil
 	}
-	err := r.client.GetRpc().BatchCall(reqs)
+	err := r.client.BatchCallContext(ctx, reqs)
 	if err != nil {
 		return nil, err
 	}
-	for _, req := range reqs {
+	for j, req := range reqs {
+		i := indexes[j]
 		if req.Error != nil {
-			return nil, req.Error
+			finalRes[i].Err = req.Error
+			continue
 		}
+		finalRes[i].Value, finalRes[i].Err = hexToDecimal(*resArr[j])
 	}
-	var finalRes []string
-	for _, item := range resArr {
-		ten, _ := new(big.Int).SetString((*item)[2:], 16)
-		finalRes = append(finalRes, ten.String())
-	}
-	return finalRes, err
+	return finalRes, nil
 }
 
-func (r *ETHRPCRequester) GetERC20Balances(paramArr []ERC20BalanceRpcReq) ([]string, error) {
-	name := "eth_call"
-	methodId := "0x70a08231"
-	var resArr []*string
-	var reqs []rpc.BatchElem
-	for _, param := range paramArr {
-		res := ""
-		arg := &model.CallArg{}
-		userAddress := param.UserAddress
-		arg.Gas = hexutil.EncodeUint64(30000)
-		arg.To = common.HexToAddress(param.ContractAddress)
-		arg.Data = methodId + "000000000000000000000000" + userAddress[2:]
-		req := rpc.BatchElem{
-			Method: name,
-			Args:   []interface{}{arg, "latest"},
-			Result: &res,
-		}
-		reqs = append(reqs, req)
-		resArr = append(resArr, &res)
-	}
-	err := r.client.GetRpc().BatchCall(reqs)
+// GetERC20Balances 批量查询代币余额，按代币的 decimals 格式化，比如 decimals 为 6 时 1500000 返回 "1.5"
+func (r *ETHRPCRequester) GetERC20Balances(paramArr []ERC20BalanceRpcReq) ([]BatchResult[string], error) {
+	return r.GetERC20BalancesContext(context.Background(), paramArr)
+}
+
+func (r *ETHRPCRequester) GetERC20BalancesContext(ctx context.Context, paramArr []ERC20BalanceRpcReq) ([]BatchResult[string], error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	return r.getERC20Balances(ctx, paramArr, "latest")
+}
+
+func (r *ETHRPCRequester) GetERC20BalancesAt(ctx context.Context, paramArr []ERC20BalanceRpcReq, block BlockSelector) ([]BatchResult[string], BlockRef, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	ref, param, err := r.resolveBlock(ctx, block)
 	if err != nil {
-		return nil, err
-	}
-	for _, req := range reqs {
-		if req.Error != nil {
-			return nil, req.Error
-		}
+		return nil, BlockRef{}, err
 	}
-	var finalRes []string
-	for _, item := range resArr {
-		if *item == "" {
+	res, err := r.getERC20Balances(ctx, paramArr, param)
+	return res, ref, err
+}
+
+func (r *ETHRPCRequester) getERC20Balances(ctx context.Context, paramArr []ERC20BalanceRpcReq, block interface{}) ([]BatchResult[string], error) {
+	contracts := make([]string, len(paramArr))
+	calls := make([]*tokenCall, len(paramArr))
+	fallbackDecimals := make([]int, len(paramArr))
+	for i, param := range paramArr {
+		fallbackDecimals[i] = param.ContractDecimal
+		if err := r.resolveAddressArgs(ctx, &param.ContractAddress, &param.UserAddress); err != nil {
+			calls[i] = &tokenCall{err: err}
 			continue
 		}
-		ten, _ := new(big.Int).SetString((*item)[2:], 16)
-		finalRes = append(finalRes, ten.String())
+		contracts[i] = param.ContractAddress
+		data, _ := erc20Abi.Pack("balanceOf", common.HexToAddress(param.UserAddress))
+		calls[i] = &tokenCall{to: common.HexToAddress(param.ContractAddress), data: data}
 	}
-	return finalRes, err
+	return r.getTokenAmounts(ctx, "balanceOf", contracts, calls, fallbackDecimals, block)
 }
 
 func (r *ETHRPCRequester) GetLastestBlockNumber() (*big.Int, error) {
+	return r.GetLastestBlockNumberContext(context.Background())
+}
+
+func (r *ETHRPCRequester) GetLastestBlockNumberContext(ctx context.Context) (*big.Int, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
 	name := "eth_blockNumber"
 	number := ""
-	err := r.client.GetRpc().Call(&number, name)
+	err := r.client.CallContext(ctx, &number, name)
 	if err != nil {
 		return nil, err
 	}
@@ -157,10 +343,16 @@ func (r *ETHRPCRequester) GetLastestBlockNumber() (*big.Int, error) {
 }
 
 func (r *ETHRPCRequester) GetBlockInfoByNumber(blockNumber *big.Int) (*model.FullBlock, error) {
+	return r.GetBlockInfoByNumberContext(context.Background(), blockNumber)
+}
+
+func (r *ETHRPCRequester) GetBlockInfoByNumberContext(ctx context.Context, blockNumber *big.Int) (*model.FullBlock, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
 	number := fmt.Sprintf("%#x", blockNumber)
 	name := "eth_getBlockByNumber"
 	fullBlock := &model.FullBlock{}
-	err := r.client.GetRpc().Call(fullBlock, name, number, true)
+	err := r.client.CallContext(ctx, fullBlock, name, number, true)
 	if err != nil {
 		return nil, err
 	}
@@ -171,27 +363,56 @@ func (r *ETHRPCRequester) GetBlockInfoByNumber(blockNumber *big.Int) (*model.Ful
 }
 
 func (r *ETHRPCRequester) GetBlockInfoByHash(blockHash string) (*model.FullBlock, error) {
+	return r.GetBlockInfoByHashContext(context.Background(), blockHash)
+}
+
+func (r *ETHRPCRequester) GetBlockInfoByHashContext(ctx context.Context, blockHash string) (*model.FullBlock, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
 	name := "eth_getBlockByHash"
 	fullBlock := &model.FullBlock{}
-	err := r.client.GetRpc().Call(fullBlock, name, blockHash, true)
+	if r.cache != nil && r.cache.Get(blockKey(blockHash), fullBlock) {
+		return fullBlock, nil
+	}
+	err := r.client.CallContext(ctx, fullBlock, name, blockHash, true)
 	if err != nil {
 		return nil, err
 	}
 	if fullBlock.Number == "" {
 		return nil, errors.New("block info is empty")
 	}
+	if r.cache != nil {
+		// 区块 hash 唯一确定区块内容，即使之后被回滚也不会变
+		r.cache.Put(blockKey(fullBlock.Hash), "", fullBlock)
+	}
 	return fullBlock, nil
 }
 
 func (r *ETHRPCRequester) ETHCall(request interface{}, arg model.CallArg) error {
+	return r.ETHCallContext(context.Background(), request, arg)
+}
+
+func (r *ETHRPCRequester) ETHCallContext(ctx context.Context, request interface{}, arg model.CallArg) error {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
 	name := "eth_call"
-	err := r.client.GetRpc().Call(request, name, arg, "latest")
+	err := r.client.CallContext(ctx, request, name, arg, "latest")
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func (r *ETHRPCRequester) ETHCallAt(ctx context.Context, request interface{}, arg model.CallArg, block BlockSelector) (BlockRef, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	ref, param, err := r.resolveBlock(ctx, block)
+	if err != nil {
+		return BlockRef{}, err
+	}
+	return ref, r.client.CallContext(ctx, request, "eth_call", arg, param)
+}
+
 func (r *ETHRPCRequester) CreateETHWallet(password string) (string, error) {
 	if password == "" {
 		return "", errors.New("password is empty")
@@ -209,7 +430,34 @@ func (r *ETHRPCRequester) CreateETHWallet(password string) (string, error) {
 }
 
 func (r *ETHRPCRequester) SendTransaction(address string, transaction *types.Transaction) (string, error) {
-	signTx, err := tool.SignETHTransaction(address, transaction)
+	return r.SendTransactionContext(context.Background(), address, transaction)
+}
+
+// SendTransactionContext 签名前先预执行，交易会回滚时返回 *ExecutionRevertedError 而不广播，
+// gas limit 为 0 时使用预执行估算的值；设置 SimulationOptions.Disabled 后不预执行，直接签名广播
+func (r *ETHRPCRequester) SendTransactionContext(ctx context.Context, address string, transaction *types.Transaction) (string, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Broadcast)
+	defer cancel()
+	if err := r.resolveAddressArgs(ctx, &address); err != nil {
+		return "", err
+	}
+	if !r.simulation.Disabled {
+		gas, err := r.SimulateTransactionContext(ctx, address, transaction, "")
+		if err != nil {
+			return "", err
+		}
+		if transaction.Gas() == 0 {
+			if transaction, err = withGasLimit(transaction, gas); err != nil {
+				return "", err
+			}
+		}
+	}
+	// 按节点的 chainId 做 EIP-155 签名，防止交易在其他链上被重放
+	chainId, err := r.GetChainIdContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	signTx, err := tool.SignETHTransaction(address, transaction, chainId)
 	if err != nil {
 		return "", err
 	}
@@ -219,7 +467,7 @@ func (r *ETHRPCRequester) SendTransaction(address string, transaction *types.Tra
 	}
 	txHash := ""
 	name := "eth_sendRawTransaction"
-	err = r.client.GetRpc().Call(&txHash, name, hexutil.Encode(txRlpData))
+	err = r.client.CallContext(ctx, &txHash, name, hexutil.Encode(txRlpData))
 	if err != nil {
 		return "", err
 	}
@@ -232,9 +480,33 @@ func (r *ETHRPCRequester) SendTransaction(address string, transaction *types.Tra
 }
 
 func (r *ETHRPCRequester) GetNonce(address string) (uint64, error) {
+	return r.GetNonceContext(context.Background(), address)
+}
+
+func (r *ETHRPCRequester) GetNonceContext(ctx context.Context, address string) (uint64, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.getNonce(ctx, address, "pending")
+}
+
+func (r *ETHRPCRequester) GetNonceAt(ctx context.Context, address string, block BlockSelector) (uint64, BlockRef, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	ref, param, err := r.resolveBlock(ctx, block)
+	if err != nil {
+		return 0, BlockRef{}, err
+	}
+	nonce, err := r.getNonce(ctx, address, param)
+	return nonce, ref, err
+}
+
+func (r *ETHRPCRequester) getNonce(ctx context.Context, address string, block interface{}) (uint64, error) {
+	if err := r.resolveAddressArgs(ctx, &address); err != nil {
+		return 0, err
+	}
 	name := "eth_getTransactionCount"
 	nonce := ""
-	err := r.client.GetRpc().Call(&nonce, name, address, "pending")
+	err := r.client.CallContext(ctx, &nonce, name, address, block)
 	if err != nil {
 		return 0, err
 	}
@@ -243,58 +515,222 @@ func (r *ETHRPCRequester) GetNonce(address string) (uint64, error) {
 }
 
 func (r *ETHRPCRequester) SendETHTransaction(fromStr, toStr, value string, gasLimit, gasPrice uint64) (string, error) {
+	return r.SendETHTransactionContext(context.Background(), fromStr, toStr, value, gasLimit, gasPrice)
+}
+
+func (r *ETHRPCRequester) SendETHTransactionContext(ctx context.Context, fromStr, toStr, value string,
+	gasLimit, gasPrice uint64) (string, error) {
+	if err := r.resolveAddressArgs(ctx, &fromStr, &toStr); err != nil {
+		return "", err
+	}
 	_to := common.HexToAddress(toStr)
 	_gasPrice := new(big.Int).SetUint64(gasPrice)
 	_value := tool.GetRealDecimalValue(value, 18)
 	_amount, _ := new(big.Int).SetString(_value, 10)
 
-	nonce := r.nonceManager.GetNonce(fromStr)
-	if nonce == nil {
-		n, err := r.GetNonce(fromStr)
-		if err != nil {
-			return "", err
-		}
-		nonce = new(big.Int).SetUint64(n)
-		r.nonceManager.SetNonce(fromStr, nonce)
+	nonce, err := r.nextNonce(ctx, fromStr)
+	if err != nil {
+		return "", err
 	}
 
 	transaction := types.NewTx(&types.LegacyTx{
-		Nonce:    nonce.Uint64(),
+		Nonce:    nonce,
 		GasPrice: _gasPrice,
 		Gas:      gasLimit,
 		To:       &_to,
 		Value:    _amount,
 		Data:     []byte(""),
 	})
-	return r.SendTransaction(fromStr, transaction)
+	return r.SendTransactionContext(ctx, fromStr, transaction)
 }
 
+// SendERC20Transaction decimal 为负数时使用合约返回的 decimals
 func (r *ETHRPCRequester) SendERC20Transaction(fromStr, contract, receiver, valueStr string,
 	gasLimit, gasPrice uint64, decimal int) (string, error) {
+	return r.SendERC20TransactionContext(context.Background(), fromStr, contract, receiver, valueStr, gasLimit, gasPrice, decimal)
+}
+
+func (r *ETHRPCRequester) SendERC20TransactionContext(ctx context.Context, fromStr, contract, receiver, valueStr string,
+	gasLimit, gasPrice uint64, decimal int) (string, error) {
+	if err := r.resolveAddressArgs(ctx, &fromStr, &contract, &receiver); err != nil {
+		return "", err
+	}
 	_to := common.HexToAddress(contract)
 	_gasPrice := new(big.Int).SetUint64(gasPrice)
 	_amount := new(big.Int).SetInt64(0)
 
-	nonce := r.nonceManager.GetNonce(fromStr)
-	if nonce == nil {
-		n, err := r.GetNonce(fromStr)
-		if err != nil {
-			return "", err
-		}
-		nonce = new(big.Int).SetUint64(n)
-		r.nonceManager.SetNonce(fromStr, nonce)
+	decimal, err := r.tokenDecimals(ctx, contract, decimal)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := r.nextNonce(ctx, fromStr)
+	if err != nil {
+		return "", err
 	}
 
 	data := tool.BuildERC20TransferData(valueStr, receiver, decimal)
 	dataBytes := common.FromHex(data)
 
 	transaction := types.NewTx(&types.LegacyTx{
-		Nonce:    nonce.Uint64(),
+		Nonce:    nonce,
 		GasPrice: _gasPrice,
 		Gas:      gasLimit,
 		To:       &_to,
 		Value:    _amount,
 		Data:     dataBytes,
 	})
-	return r.SendTransaction(fromStr, transaction)
+	return r.SendTransactionContext(ctx, fromStr, transaction)
+}
+
+// SendETHTransactionWithFee 使用手续费估算的档位代替固定的 gasPrice，支持 EIP-1559 的链发送 type 2 交易
+func (r *ETHRPCRequester) SendETHTransactionWithFee(fromStr, toStr, value string, gasLimit uint64, tier FeeTier) (string, error) {
+	return r.SendETHTransactionWithFeeContext(context.Background(), fromStr, toStr, value, gasLimit, tier)
+}
+
+func (r *ETHRPCRequester) SendETHTransactionWithFeeContext(ctx context.Context, fromStr, toStr, value string,
+	gasLimit uint64, tier FeeTier) (string, error) {
+	if err := r.resolveAddressArgs(ctx, &fromStr, &toStr); err != nil {
+		return "", err
+	}
+	_to := common.HexToAddress(toStr)
+	_value := tool.GetRealDecimalValue(value, 18)
+	_amount, _ := new(big.Int).SetString(_value, 10)
+	return r.sendWithFee(ctx, fromStr, _to, _amount, nil, gasLimit, tier)
+}
+
+func (r *ETHRPCRequester) SendERC20TransactionWithFee(fromStr, contract, receiver, valueStr string,
+	gasLimit uint64, decimal int, tier FeeTier) (string, error) {
+	return r.SendERC20TransactionWithFeeContext(context.Background(), fromStr, contract, receiver, valueStr, gasLimit, decimal, tier)
+}
+
+func (r *ETHRPCRequester) SendERC20TransactionWithFeeContext(ctx context.Context, fromStr, contract, receiver, valueStr string,
+	gasLimit uint64, decimal int, tier FeeTier) (string, error) {
+	if err := r.resolveAddressArgs(ctx, &fromStr, &contract, &receiver); err != nil {
+		return "", err
+	}
+	decimal, err := r.tokenDecimals(ctx, contract, decimal)
+	if err != nil {
+		return "", err
+	}
+	data := tool.BuildERC20TransferData(valueStr, receiver, decimal)
+	return r.sendWithFee(ctx, fromStr, common.HexToAddress(contract), big.NewInt(0), common.FromHex(data), gasLimit, tier)
+}
+
+func (r *ETHRPCRequester) sendWithFee(ctx context.Context, fromStr string, to common.Address, amount *big.Int,
+	data []byte, gasLimit uint64, tier FeeTier) (string, error) {
+	fees, err := r.SuggestFeesContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	fee, ok := fees.Tiers[tier]
+	if !ok {
+		return "", fmt.Errorf("unknown fee tier %q", tier)
+	}
+	nonce, err := r.nextNonce(ctx, fromStr)
+	if err != nil {
+		return "", err
+	}
+	var transaction *types.Transaction
+	if fee.Legacy {
+		transaction = types.NewTx(&types.LegacyTx{
+			Nonce:    nonce,
+			GasPrice: fee.GasPrice,
+			Gas:      gasLimit,
+			To:       &to,
+			Value:    amount,
+			Data:     data,
+		})
+	} else {
+		chainId, err := r.GetChainIdContext(ctx)
+		if err != nil {
+			return "", err
+		}
+		transaction = types.NewTx(&types.DynamicFeeTx{
+			ChainID:   chainId,
+			Nonce:     nonce,
+			GasTipCap: fee.MaxPriorityFeePerGas,
+			GasFeeCap: fee.MaxFeePerGas,
+			Gas:       gasLimit,
+			To:        &to,
+			Value:     amount,
+			Data:      data,
+		})
+	}
+	return r.SendTransactionContext(ctx, fromStr, transaction)
+}
+
+// nextNonce 优先使用本地维护的 nonce，没有时从节点读取 pending nonce
+func (r *ETHRPCRequester) nextNonce(ctx context.Context, address string) (uint64, error) {
+	nonce := r.nonceManager.GetNonce(address)
+	if nonce == nil {
+		n, err := r.GetNonceContext(ctx, address)
+		if err != nil {
+			return 0, err
+		}
+		nonce = new(big.Int).SetUint64(n)
+		r.nonceManager.SetNonce(address, nonce)
+	}
+	return nonce.Uint64(), nil
+}
+
+func (r *ETHRPCRequester) SubscribeNewHeads(ch chan<- *model.Header) (*rpc.ClientSubscription, error) {
+	return r.SubscribeNewHeadsContext(context.Background(), ch)
+}
+
+func (r *ETHRPCRequester) SubscribeNewHeadsContext(ctx context.Context, ch chan<- *model.Header) (*rpc.ClientSubscription, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	client, err := r.client.GetRpc()
+	if err != nil {
+		return nil, err
+	}
+	return client.EthSubscribe(ctx, ch, "newHeads")
+}
+
+func (r *ETHRPCRequester) SubscribeLogs(ch chan<- model.Log, filter model.LogFilter) (*rpc.ClientSubscription, error) {
+	return r.SubscribeLogsContext(context.Background(), ch, filter)
+}
+
+func (r *ETHRPCRequester) SubscribeLogsContext(ctx context.Context, ch chan<- model.Log, filter model.LogFilter) (*rpc.ClientSubscription, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	client, err := r.client.GetRpc()
+	if err != nil {
+		return nil, err
+	}
+	return client.EthSubscribe(ctx, ch, "logs", filter)
+}
+
+func (r *ETHRPCRequester) SubscribeNewPendingTransactions(ch chan<- string) (*rpc.ClientSubscription, error) {
+	return r.SubscribeNewPendingTransactionsContext(context.Background(), ch)
+}
+
+func (r *ETHRPCRequester) SubscribeNewPendingTransactionsContext(ctx context.Context, ch chan<- string) (*rpc.ClientSubscription, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	client, err := r.client.GetRpc()
+	if err != nil {
+		return nil, err
+	}
+	return client.EthSubscribe(ctx, ch, "newPendingTransactions")
+}
+
+// hexToDecimal 把 rpc 返回的 0x 开头的十六进制数转成十进制字符串
+func hexToDecimal(hex string) (string, error) {
+	if len(hex) < 3 {
+		return "", fmt.Errorf("invalid hex number %q", hex)
+	}
+	ten, ok := new(big.Int).SetString(hex[2:], 16)
+	if !ok {
+		return "", fmt.Errorf("invalid hex number %q", hex)
+	}
+	return ten.String(), nil
+}
+
+// withDefaultTimeout 调用方已经设置了 deadline 时以调用方为准
+func withDefaultTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
 }
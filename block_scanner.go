@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"eth-relay/dao"
@@ -10,6 +11,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 type BlockScanner struct {
@@ -18,18 +21,27 @@ type BlockScanner struct {
 	lastBlock    *dao.Block
 	lastNumber   *big.Int
 	fork         bool
-	stop         chan bool
+	ctx          context.Context // Stop 时取消，用于中断正在进行的 rpc 请求
+	cancel       context.CancelFunc
 	lock         sync.Mutex
+	heads        chan *model.Header      // newHeads 订阅推送的区块头
+	headSub      *rpc.ClientSubscription // 为 nil 时使用轮询模式
+	headNumber   *big.Int                // 订阅收到的最新区块号
+	resubDelay   time.Duration           // 重新订阅失败后的等待时间，指数增长
+	resubAt      time.Time               // 下一次尝试重新订阅的时间
 }
 
 func NewBlockScanner(ethRequester ETHRPCRequester, mysql dao.MySQLConnector) *BlockScanner {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &BlockScanner{
 		ethRequester: ethRequester,
 		mysql:        mysql,
 		lastBlock:    &dao.Block{},
 		fork:         false,
-		stop:         make(chan bool),
+		ctx:          ctx,
+		cancel:       cancel,
 		lock:         sync.Mutex{},
+		heads:        make(chan *model.Header, 16),
 	}
 }
 
@@ -39,17 +51,25 @@ func (s *BlockScanner) Start() error {
 		s.lock.Unlock()
 		return err
 	}
+	s.subscribeHeads()
 	execute := func() {
 		if err := s.scan(); err != nil {
 			s.log(err.Error())
+			s.waitConnected()
 			return
 		}
-		time.Sleep(1 * time.Second)
+		s.waitNextBlock()
 	}
 	go func() {
+		// headSub 只在扫描协程中读写，退出时在这里取消订阅
+		defer func() {
+			if s.headSub != nil {
+				s.headSub.Unsubscribe()
+			}
+		}()
 		for {
 			select {
-			case <-s.stop:
+			case <-s.ctx.Done():
 				s.log("block scanner stopped")
 				return
 			default:
@@ -68,17 +88,22 @@ func (s *BlockScanner) Start() error {
 	return nil
 }
 
+// Stop 停止扫描，并中断正在进行的 rpc 请求，newHeads 订阅由扫描协程退出时取消
+func (s *BlockScanner) Stop() {
+	s.cancel()
+}
+
 func (s *BlockScanner) init() error {
 	_, err := s.mysql.Db.Desc("create_time").Where("fork=?", false).Get(s.lastBlock)
 	if err != nil {
 		return err
 	}
 	if s.lastBlock.BlockHash == "" {
-		latestBlockNumber, err := s.ethRequester.GetLastestBlockNumber()
+		latestBlockNumber, err := s.ethRequester.GetLastestBlockNumberContext(s.ctx)
 		if err != nil {
 			return err
 		}
-		lastestBlock, err := s.ethRequester.GetBlockInfoByNumber(latestBlockNumber)
+		lastestBlock, err := s.ethRequester.GetBlockInfoByNumberContext(s.ctx, latestBlockNumber)
 		if err != nil {
 			return err
 		}
@@ -97,8 +122,85 @@ func (s *BlockScanner) init() error {
 	return nil
 }
 
+// subscribeHeads 节点支持订阅时，用 newHeads 推送代替固定间隔的轮询
+func (s *BlockScanner) subscribeHeads() {
+	if !s.ethRequester.client.SupportsSubscriptions() {
+		return
+	}
+	sub, err := s.ethRequester.SubscribeNewHeadsContext(s.ctx, s.heads)
+	if err != nil {
+		s.log("订阅 newHeads 失败，使用轮询模式", err.Error())
+		return
+	}
+	s.headSub = sub
+}
+
+// waitConnected 所有节点都断开时等待客户端重连成功，而不是空转报错
+func (s *BlockScanner) waitConnected() {
+	client := s.ethRequester.client
+	if client.State() != StateReconnecting {
+		return
+	}
+	s.log("rpc 节点全部断开，等待重连......")
+	if err := client.WaitConnected(s.ctx); err != nil {
+		return
+	}
+	s.log("rpc 节点已重新连接")
+	if s.headSub == nil {
+		s.subscribeHeads()
+	}
+}
+
+// resubscribeHeads 订阅断开后在轮询的同时按指数退避尝试重新订阅，退避参数与客户端断线重连相同
+func (s *BlockScanner) resubscribeHeads() {
+	if time.Now().Before(s.resubAt) || !s.ethRequester.client.SupportsSubscriptions() {
+		return
+	}
+	s.subscribeHeads()
+	if s.headSub != nil {
+		s.log("newHeads 重新订阅成功")
+		s.resubDelay = 0
+		return
+	}
+	options := s.ethRequester.client.options
+	s.resubDelay *= 2
+	if s.resubDelay == 0 {
+		s.resubDelay = options.ReconnectBaseDelay
+	}
+	if s.resubDelay > options.ReconnectMaxDelay {
+		s.resubDelay = options.ReconnectMaxDelay
+	}
+	s.resubAt = time.Now().Add(s.resubDelay)
+}
+
+func (s *BlockScanner) waitNextBlock() {
+	if s.headSub == nil {
+		s.resubscribeHeads()
+	}
+	if s.headSub == nil {
+		select {
+		case <-s.ctx.Done():
+		case <-time.After(1 * time.Second):
+		}
+		return
+	}
+	// 还没追上订阅到的最新区块，继续扫描
+	if s.headNumber != nil && s.lastNumber.Cmp(s.headNumber) <= 0 {
+		return
+	}
+	select {
+	case head := <-s.heads:
+		s.headNumber = s.hexToTen(head.Number)
+	case err := <-s.headSub.Err():
+		s.log("newHeads 订阅断开，重新订阅前使用轮询模式", err)
+		s.headSub = nil
+		s.resubAt = time.Time{}
+	case <-s.ctx.Done():
+	}
+}
+
 func (s *BlockScanner) getScannerBlockNumber() (*big.Int, error) {
-	newBlockNumber, err := s.ethRequester.GetLastestBlockNumber()
+	newBlockNumber, err := s.ethRequester.GetLastestBlockNumberContext(s.ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -107,8 +209,10 @@ func (s *BlockScanner) getScannerBlockNumber() (*big.Int, error) {
 	Next:
 		for {
 			select {
+			case <-s.ctx.Done():
+				return nil, s.ctx.Err()
 			case <-time.After(4 * time.Second):
-				number, err := s.ethRequester.GetLastestBlockNumber()
+				number, err := s.ethRequester.GetLastestBlockNumberContext(s.ctx)
 				if err == nil && number.Cmp(s.lastNumber) >= 0 {
 					targetNumber = number
 					break Next
@@ -207,6 +311,12 @@ func (s *BlockScanner) forkCheck(currentBlock *dao.Block) bool {
 		numberEnd = c.String()
 	}
 	numberFrom := forkBlock.BlockNumber
+	var forkBlocks []dao.Block
+	if err := s.mysql.Db.Where("block_number > ? and block_number <= ?", numberFrom, numberEnd).Find(&forkBlocks); err == nil {
+		for _, b := range forkBlocks {
+			s.ethRequester.InvalidateBlock(b.BlockHash) // 分叉区块中交易的缓存已经不可信
+		}
+	}
 	_, err = s.mysql.Db.
 		Table(dao.Block{}).
 		Where("block_number > ? and block_number <= ?", numberFrom, numberEnd). // 区块号范围内
@@ -232,7 +342,7 @@ func (s *BlockScanner) getStartForkBlock(parentHash string) (*dao.Block, error)
 
 func (s *BlockScanner) retryGetBlockInfoByHash(hash string) (*model.FullBlock, error) {
 Retry:
-	fullBlock, err := s.ethRequester.GetBlockInfoByHash(hash)
+	fullBlock, err := s.ethRequester.GetBlockInfoByHashContext(s.ctx, hash)
 	if err != nil {
 		errInfo := err.Error()
 		if strings.Contains(errInfo, "empty") {
@@ -246,7 +356,7 @@ Retry:
 
 func (s *BlockScanner) retryGetBlockInfoByNumber(targetNumber *big.Int) (*model.FullBlock, error) {
 Retry:
-	fullBlock, err := s.ethRequester.GetBlockInfoByNumber(targetNumber)
+	fullBlock, err := s.ethRequester.GetBlockInfoByNumberContext(s.ctx, targetNumber)
 	if err != nil {
 		errInfo := err.Error()
 		if strings.Contains(errInfo, "empty") {
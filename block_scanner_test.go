@@ -2,16 +2,21 @@ package main
 
 import (
 	"eth-relay/dao"
+	"eth-relay/model"
+	"math/big"
+	"os"
 	"testing"
+	"time"
 )
 
+// 需要 MySQL 和真实节点，设置 MYSQL_DSN 后手动运行
 func TestBlockScanner_Start(t *testing.T) {
+	dsn := os.Getenv("MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("MYSQL_DSN not set")
+	}
 	option := dao.MysqlOptions{
-		Hostname:           "localhost",
-		Port:               "6034",
-		DbName:             "eth_relay",
-		User:               "root",
-		Password:           "123",
+		DSN:                dsn,
 		TablePrefix:        "eth_",
 		MaxOpenConnections: 10,
 		MaxIdleConnections: 5,
@@ -22,11 +27,65 @@ func TestBlockScanner_Start(t *testing.T) {
 	tables = append(tables, dao.Block{}, dao.Transaction{})
 	mysql := dao.NewMqSQLConnector(&option, tables)
 
-	requester := NewETHRPCRequester(sepoliaUrl)
+	requester, err := NewETHRPCRequester(localUrl)
+	if err != nil {
+		panic(err)
+	}
 	scanner := NewBlockScanner(*requester, mysql)
-	err := scanner.Start()
+	err = scanner.Start()
 	if err != nil {
 		panic(err)
 	}
 	select {}
 }
+
+func TestBlockScanner_Resubscribe(t *testing.T) {
+	service := newNewHeadsService()
+	url, drop := newFakeWsNode(t, "eth", service)
+	requester, err := NewETHRPCRequesterWithOptions(&ClientOptions{
+		NodeUrls:           []string{url},
+		ReconnectBaseDelay: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := NewBlockScanner(*requester, dao.MySQLConnector{})
+	// 没有启动扫描协程，订阅由测试自己取消
+	defer func() {
+		scanner.Stop()
+		if scanner.headSub != nil {
+			scanner.headSub.Unsubscribe()
+		}
+	}()
+	scanner.lastNumber = big.NewInt(2)
+	scanner.subscribeHeads()
+	if scanner.headSub == nil {
+		t.Fatal("expected newHeads subscription")
+	}
+	service.heads <- &model.Header{Number: "0x1"}
+	scanner.waitNextBlock()
+	if scanner.headNumber == nil || scanner.headNumber.Int64() != 1 {
+		t.Fatalf("unexpected head number %v", scanner.headNumber)
+	}
+
+	// 连接断开后订阅报错，之后应该重新订阅，而不是一直轮询
+	drop()
+	scanner.waitNextBlock()
+	if scanner.headSub != nil {
+		t.Fatal("expected subscription error")
+	}
+	// 还没追上订阅到的区块时不等待推送，只检查是否重新订阅
+	scanner.lastNumber = big.NewInt(1)
+	for i := 0; i < 5 && scanner.headSub == nil; i++ {
+		scanner.waitNextBlock()
+	}
+	if scanner.headSub == nil || service.subs.Load() != 2 {
+		t.Fatalf("expected resubscription, subscriptions %d", service.subs.Load())
+	}
+	scanner.lastNumber = big.NewInt(2)
+	service.heads <- &model.Header{Number: "0x2"}
+	scanner.waitNextBlock()
+	if scanner.headNumber.Int64() != 2 {
+		t.Fatalf("unexpected head number %v", scanner.headNumber)
+	}
+}
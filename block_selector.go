@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"eth-relay/model"
+	"fmt"
+	"math/big"
+)
+
+// BlockSelector 状态查询读取的区块：区块号、区块 hash（EIP-1898）或者 latest、pending、safe、finalized 标签
+type BlockSelector struct {
+	number           *big.Int
+	hash             string
+	requireCanonical bool
+	tag              string
+}
+
+var (
+	AtLatest    = BlockSelector{tag: "latest"}
+	AtPending   = BlockSelector{tag: "pending"}
+	AtSafe      = BlockSelector{tag: "safe"}      // 大概率不会被回滚的区块
+	AtFinalized = BlockSelector{tag: "finalized"} // 已经最终确认的区块
+)
+
+func AtBlockNumber(number *big.Int) BlockSelector {
+	return BlockSelector{number: new(big.Int).Set(number)}
+}
+
+// AtBlockHash requireCanonical 为 true 时，区块已经不在主链上则查询失败
+func AtBlockHash(blockHash string, requireCanonical bool) BlockSelector {
+	return BlockSelector{hash: blockHash, requireCanonical: requireCanonical}
+}
+
+func (s BlockSelector) String() string {
+	switch {
+	case s.hash != "":
+		return s.hash
+	case s.number != nil:
+		return s.number.String()
+	}
+	return s.tag
+}
+
+// BlockRef 数据实际读取的区块，pending 区块没有 hash
+type BlockRef struct {
+	Number *big.Int
+	Hash   string
+}
+
+// resolveBlock 把选择器固定到具体的区块，返回该区块以及 rpc 使用的区块参数。
+// 除 pending 外都按 hash 读取，保证多次读取以及返回的 BlockRef 对应同一个区块
+func (r *ETHRPCRequester) resolveBlock(ctx context.Context, block BlockSelector) (BlockRef, interface{}, error) {
+	_, ref, param, err := r.resolveBlockHeader(ctx, block)
+	return ref, param, err
+}
+
+// resolveBlockHeader 同 resolveBlock，同时返回节点返回的原始区块 json，用于在本地重新计算区块 hash
+func (r *ETHRPCRequester) resolveBlockHeader(ctx context.Context, block BlockSelector) (json.RawMessage, BlockRef, interface{}, error) {
+	raw := json.RawMessage{}
+	var err error
+	switch {
+	case block.hash != "":
+		err = r.client.CallContext(ctx, &raw, "eth_getBlockByHash", block.hash, false)
+	case block.number != nil:
+		err = r.client.CallContext(ctx, &raw, "eth_getBlockByNumber", fmt.Sprintf("%#x", block.number), false)
+	case block.tag != "":
+		err = r.client.CallContext(ctx, &raw, "eth_getBlockByNumber", block.tag, false)
+	default:
+		return nil, BlockRef{}, nil, fmt.Errorf("empty block selector")
+	}
+	if err != nil {
+		return nil, BlockRef{}, nil, err
+	}
+	header := &model.Header{}
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, header); err != nil {
+			return nil, BlockRef{}, nil, fmt.Errorf("invalid block %s %s", block, err.Error())
+		}
+	}
+	if header.Number == "" {
+		return nil, BlockRef{}, nil, fmt.Errorf("block %s not found", block)
+	}
+	number, ok := new(big.Int).SetString(header.Number[2:], 16)
+	if !ok {
+		return nil, BlockRef{}, nil, fmt.Errorf("invalid block number %s", header.Number)
+	}
+	if block.tag == "pending" {
+		return raw, BlockRef{Number: number}, "pending", nil
+	}
+	// 按号或者标签选择时，要求读取期间该区块仍在主链上
+	requireCanonical := block.hash == "" || block.requireCanonical
+	param := map[string]interface{}{"blockHash": header.Hash, "requireCanonical": requireCanonical}
+	return raw, BlockRef{Number: number, Hash: header.Hash}, param, nil
+}
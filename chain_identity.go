@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"eth-relay/dao"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var ErrChainMismatch = errors.New("rpc node and database belong to different chains")
+
+const (
+	metaChainId     = "chain_id"
+	metaGenesisHash = "genesis_hash"
+)
+
+// ChainIdentity 用 chainId 和创世区块 hash 唯一确定一条链
+type ChainIdentity struct {
+	ChainId     *big.Int
+	GenesisHash string
+}
+
+// chainInfo 节点的 chainId 不会变化，第一次查询后缓存
+type chainInfo struct {
+	lock    sync.Mutex
+	chainId *big.Int
+}
+
+func (r *ETHRPCRequester) GetChainId() (*big.Int, error) {
+	return r.GetChainIdContext(context.Background())
+}
+
+func (r *ETHRPCRequester) GetChainIdContext(ctx context.Context) (*big.Int, error) {
+	r.chain.lock.Lock()
+	defer r.chain.lock.Unlock()
+	if r.chain.chainId != nil {
+		return new(big.Int).Set(r.chain.chainId), nil
+	}
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	result := ""
+	if err := r.client.CallContext(ctx, &result, "eth_chainId"); err != nil {
+		return nil, err
+	}
+	chainId, err := hexutil.DecodeBig(result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chain id %s: %s", result, err.Error())
+	}
+	r.chain.chainId = chainId
+	return new(big.Int).Set(chainId), nil
+}
+
+func (r *ETHRPCRequester) GetChainIdentity() (*ChainIdentity, error) {
+	return r.GetChainIdentityContext(context.Background())
+}
+
+func (r *ETHRPCRequester) GetChainIdentityContext(ctx context.Context) (*ChainIdentity, error) {
+	chainId, err := r.GetChainIdContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	genesis, err := r.GetBlockInfoByNumberContext(ctx, big.NewInt(0))
+	if err != nil {
+		return nil, fmt.Errorf("get genesis block failed %s", err.Error())
+	}
+	return &ChainIdentity{ChainId: chainId, GenesisHash: strings.ToLower(genesis.Hash)}, nil
+}
+
+// CheckChainIdentity 读取节点的 chainId 和创世区块 hash，与数据库 metadata 表中记录的比较。
+// 数据库还没有记录时写入；不一致时返回 ErrChainMismatch，防止把两条链的数据混在一起
+func CheckChainIdentity(ctx context.Context, requester *ETHRPCRequester, mysql dao.MySQLConnector) (*ChainIdentity, error) {
+	identity, err := requester.GetChainIdentityContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var metas []dao.Metadata
+	if err := mysql.Db.In("name", metaChainId, metaGenesisHash).Find(&metas); err != nil {
+		return nil, fmt.Errorf("read chain metadata failed %s", err.Error())
+	}
+	stored := map[string]string{}
+	for _, meta := range metas {
+		stored[meta.Name] = meta.Value
+	}
+	chainId, hasChainId := stored[metaChainId]
+	genesisHash, hasGenesis := stored[metaGenesisHash]
+	if (hasChainId && chainId != identity.ChainId.String()) || (hasGenesis && genesisHash != identity.GenesisHash) {
+		return nil, fmt.Errorf("%w: database chain %s genesis %s, node chain %s genesis %s",
+			ErrChainMismatch, chainId, genesisHash, identity.ChainId, identity.GenesisHash)
+	}
+	if hasChainId && hasGenesis {
+		return identity, nil
+	}
+	// 老版本的数据库没有 metadata，用已经扫描过的区块确认是同一条链
+	if !hasChainId && !hasGenesis {
+		if err := checkIndexedBlock(ctx, requester, mysql); err != nil {
+			return nil, err
+		}
+	}
+	session := mysql.Db.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+	if !hasChainId {
+		if _, err := session.Insert(&dao.Metadata{Name: metaChainId, Value: identity.ChainId.String()}); err != nil {
+			_ = session.Rollback()
+			return nil, fmt.Errorf("save chain metadata failed %s", err.Error())
+		}
+	}
+	if !hasGenesis {
+		if _, err := session.Insert(&dao.Metadata{Name: metaGenesisHash, Value: identity.GenesisHash}); err != nil {
+			_ = session.Rollback()
+			return nil, fmt.Errorf("save chain metadata failed %s", err.Error())
+		}
+	}
+	if err := session.Commit(); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func checkIndexedBlock(ctx context.Context, requester *ETHRPCRequester, mysql dao.MySQLConnector) error {
+	block := dao.Block{}
+	has, err := mysql.Db.Where("fork=?", false).Asc("id").Get(&block)
+	if err != nil {
+		return fmt.Errorf("read indexed block failed %s", err.Error())
+	}
+	if !has {
+		return nil
+	}
+	number, ok := new(big.Int).SetString(block.BlockNumber, 10)
+	if strings.HasPrefix(block.BlockNumber, "0x") {
+		number, ok = new(big.Int).SetString(block.BlockNumber[2:], 16)
+	}
+	if !ok {
+		return fmt.Errorf("invalid indexed block number %s", block.BlockNumber)
+	}
+	nodeBlock, err := requester.GetBlockInfoByNumberContext(ctx, number)
+	if err != nil {
+		return fmt.Errorf("get block %s failed %s", number, err.Error())
+	}
+	if !strings.EqualFold(nodeBlock.Hash, block.BlockHash) {
+		return fmt.Errorf("%w: indexed block %s is %s, node returned %s",
+			ErrChainMismatch, number, block.BlockHash, nodeBlock.Hash)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"eth-relay/tool"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrEmptyCallResult eth_call 没有返回数据：地址不是合约，或者合约没有这个方法
+var ErrEmptyCallResult = errors.New("empty result")
+
+// ContractCaller 按合约 ABI 编码调用数据、执行 eth_call 并解析返回值
+type ContractCaller struct {
+	requester *ETHRPCRequester
+	address   common.Address
+	abiStr    string
+	abi       *abi.ABI
+}
+
+// ContractCall 批量调用中的一项。Out 为 nil 时丢弃返回值；
+// 为 *[]interface{} 时按顺序接收全部返回值；否则传给 abi.UnpackIntoInterface，可以是单个值的指针或者结构体指针
+type ContractCall struct {
+	Method string
+	Args   []interface{}
+	Out    interface{}
+}
+
+// NewContractCaller address 可以是 ENS 名字，创建时解析一次
+func (r *ETHRPCRequester) NewContractCaller(address, abiStr string) (*ContractCaller, error) {
+	return r.NewContractCallerContext(context.Background(), address, abiStr)
+}
+
+func (r *ETHRPCRequester) NewContractCallerContext(ctx context.Context, address, abiStr string) (*ContractCaller, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	if err := r.resolveAddressArgs(ctx, &address); err != nil {
+		return nil, fmt.Errorf("invalid contract address %s", err.Error())
+	}
+	_abi, err := tool.ParseABI(abiStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid abi %s", err.Error())
+	}
+	return &ContractCaller{requester: r, address: common.HexToAddress(address), abiStr: abiStr, abi: _abi}, nil
+}
+
+func (c *ContractCaller) Address() common.Address {
+	return c.address
+}
+
+// Call 在 latest 区块调用合约的只读方法，回滚时返回 *ExecutionRevertedError，自定义错误按同一个 ABI 解析
+func (c *ContractCaller) Call(ctx context.Context, out interface{}, method string, args ...interface{}) error {
+	ctx, cancel := withDefaultTimeout(ctx, c.requester.timeouts.Read)
+	defer cancel()
+	return c.call(ctx, "latest", out, method, args...)
+}
+
+// CallAt 在指定区块调用，返回实际读取的区块
+func (c *ContractCaller) CallAt(ctx context.Context, block BlockSelector, out interface{}, method string, args ...interface{}) (BlockRef, error) {
+	ctx, cancel := withDefaultTimeout(ctx, c.requester.timeouts.Read)
+	defer cancel()
+	ref, param, err := c.requester.resolveBlock(ctx, block)
+	if err != nil {
+		return BlockRef{}, err
+	}
+	return ref, c.call(ctx, param, out, method, args...)
+}
+
+func (c *ContractCaller) call(ctx context.Context, block interface{}, out interface{}, method string, args ...interface{}) error {
+	arg, err := c.callArg(method, args...)
+	if err != nil {
+		return err
+	}
+	result := hexutil.Bytes{}
+	if err := c.requester.client.CallContext(ctx, &result, "eth_call", arg, block); err != nil {
+		return decodeRevert(err, c.abiStr)
+	}
+	return c.decode(out, method, result)
+}
+
+// BatchCall 一次批量请求执行多个调用，返回的错误与 calls 按下标一一对应
+func (c *ContractCaller) BatchCall(ctx context.Context, calls []ContractCall) ([]error, error) {
+	ctx, cancel := withDefaultTimeout(ctx, c.requester.timeouts.BatchRead)
+	defer cancel()
+	errs := make([]error, len(calls))
+	var reqs []rpc.BatchElem
+	var results []*hexutil.Bytes
+	var indexes []int // reqs 中每个请求对应 calls 的下标
+	for i, call := range calls {
+		arg, err := c.callArg(call.Method, call.Args...)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		result := &hexutil.Bytes{}
+		reqs = append(reqs, rpc.BatchElem{Method: "eth_call", Args: []interface{}{arg, "latest"}, Result: result})
+		results = append(results, result)
+		indexes = append(indexes, i)
+	}
+	if len(reqs) == 0 {
+		return errs, nil
+	}
+	if err := c.requester.client.BatchCallContext(ctx, reqs); err != nil {
+		return nil, err
+	}
+	for j, req := range reqs {
+		i := indexes[j]
+		if req.Error != nil {
+			errs[i] = decodeRevert(req.Error, c.abiStr)
+			continue
+		}
+		errs[i] = c.decode(calls[i].Out, calls[i].Method, *results[j])
+	}
+	return errs, nil
+}
+
+func (c *ContractCaller) callArg(method string, args ...interface{}) (map[string]interface{}, error) {
+	data, err := c.abi.Pack(method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("pack %s failed %s", method, err.Error())
+	}
+	return map[string]interface{}{"to": c.address, "data": hexutil.Bytes(data)}, nil
+}
+
+func (c *ContractCaller) decode(out interface{}, method string, data []byte) error {
+	if len(data) == 0 && len(c.abi.Methods[method].Outputs) > 0 {
+		return fmt.Errorf("contract %s returned %w for %s", c.address.Hex(), ErrEmptyCallResult, method)
+	}
+	if out == nil {
+		return nil
+	}
+	if values, ok := out.(*[]interface{}); ok {
+		res, err := c.abi.Unpack(method, data)
+		if err != nil {
+			return fmt.Errorf("unpack %s failed %s", method, err.Error())
+		}
+		*values = res
+		return nil
+	}
+	if err := c.abi.UnpackIntoInterface(out, method, data); err != nil {
+		return fmt.Errorf("unpack %s failed %s", method, err.Error())
+	}
+	return nil
+}
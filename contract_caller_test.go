@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const testTokenAbi = `[
+	{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"info","stateMutability":"view","inputs":[],"outputs":[{"name":"symbol","type":"string"},{"name":"decimals","type":"uint8"}]},
+	{"type":"function","name":"totalSupply","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"withdraw","stateMutability":"nonpayable","inputs":[{"name":"amount","type":"uint256"}],"outputs":[]},
+	{"type":"error","name":"InsufficientBalance","inputs":[{"name":"available","type":"uint256"},{"name":"required","type":"uint256"}]}
+]`
+
+// revertError 模拟节点返回的 execution reverted 错误
+type revertError struct {
+	data string
+}
+
+func (e *revertError) Error() string          { return "execution reverted" }
+func (e *revertError) ErrorCode() int         { return 3 }
+func (e *revertError) ErrorData() interface{} { return e.data }
+
+// tokenService 余额固定为 1000 的代币合约，totalSupply 不返回数据，withdraw 金额不为 0 时以自定义错误回滚
+type tokenService struct {
+	abi *abi.ABI
+}
+
+func (s *tokenService) Call(arg map[string]interface{}, block interface{}) (hexutil.Bytes, error) {
+	data := common.FromHex(arg["data"].(string))
+	method, err := s.abi.MethodById(data[:4])
+	if err != nil {
+		return hexutil.Bytes{}, nil
+	}
+	switch method.Name {
+	case "balanceOf":
+		return method.Outputs.Pack(big.NewInt(1000))
+	case "info":
+		return method.Outputs.Pack("TST", uint8(6))
+	case "totalSupply":
+		return hexutil.Bytes{}, nil
+	case "withdraw":
+		if new(big.Int).SetBytes(data[4:]).Sign() == 0 {
+			return hexutil.Bytes{}, nil
+		}
+	}
+	customErr := s.abi.Errors["InsufficientBalance"]
+	revert, _ := customErr.Inputs.Pack(big.NewInt(1), big.NewInt(2))
+	return nil, &revertError{data: hexutil.Encode(append(customErr.ID[:4], revert...))}
+}
+
+func newTokenCaller(t *testing.T) *ContractCaller {
+	contractAbi := &abi.ABI{}
+	if err := contractAbi.UnmarshalJSON([]byte(testTokenAbi)); err != nil {
+		t.Fatal(err)
+	}
+	requester := newFakeRequester(t, "eth", &tokenService{abi: contractAbi}, nil)
+	caller, err := requester.NewContractCaller("0x6dB7d7A2B4b1Ee0c1E3d8D1b2F1B4C8F1E5A0259", testTokenAbi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return caller
+}
+
+func TestContractCaller_Call(t *testing.T) {
+	caller := newTokenCaller(t)
+	ctx := context.Background()
+	balance := new(big.Int)
+	if err := caller.Call(ctx, &balance, "balanceOf", common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266")); err != nil {
+		t.Fatal(err)
+	}
+	if balance.Int64() != 1000 {
+		t.Fatalf("unexpected balance %s", balance)
+	}
+
+	// 多个返回值解析到结构体
+	info := struct {
+		Symbol   string
+		Decimals uint8
+	}{}
+	if err := caller.Call(ctx, &info, "info"); err != nil {
+		t.Fatal(err)
+	}
+	if info.Symbol != "TST" || info.Decimals != 6 {
+		t.Fatalf("unexpected info %+v", info)
+	}
+
+	var values []interface{}
+	if err := caller.Call(ctx, &values, "info"); err != nil || len(values) != 2 {
+		t.Fatalf("unexpected values %v %v", values, err)
+	}
+
+	// 没有返回值的方法成功时返回空数据，有返回值的方法返回空数据时报错
+	if err := caller.Call(ctx, nil, "withdraw", big.NewInt(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := caller.Call(ctx, &balance, "totalSupply"); !errors.Is(err, ErrEmptyCallResult) {
+		t.Fatalf("expected empty result, got %v", err)
+	}
+
+	err := caller.Call(ctx, nil, "withdraw", big.NewInt(2))
+	var revert *ExecutionRevertedError
+	if !errors.As(err, &revert) || revert.ErrorName != "InsufficientBalance" {
+		t.Fatalf("expected custom revert, got %v", err)
+	}
+
+	if err := caller.Call(ctx, nil, "balanceOf", "not an address"); err == nil {
+		t.Fatal("expected pack error")
+	}
+}
+
+func TestContractCaller_BatchCall(t *testing.T) {
+	caller := newTokenCaller(t)
+	balance := new(big.Int)
+	calls := []ContractCall{
+		{Method: "balanceOf", Args: []interface{}{common.Address{}}, Out: &balance},
+		{Method: "withdraw", Args: []interface{}{big.NewInt(2)}},
+		{Method: "missing"},
+	}
+	errs, err := caller.BatchCall(context.Background(), calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs[0] != nil || balance.Int64() != 1000 {
+		t.Fatalf("unexpected balance %s %v", balance, errs[0])
+	}
+	var revert *ExecutionRevertedError
+	if !errors.As(errs[1], &revert) {
+		t.Fatalf("expected revert, got %v", errs[1])
+	}
+	if errs[2] == nil {
+		t.Fatal("expected error for unknown method")
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// 代理合约保存逻辑合约地址的存储槽
+var (
+	eip1967ImplementationSlot  = common.HexToHash("0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc") // keccak256("eip1967.proxy.implementation") - 1
+	eip1967BeaconSlot          = common.HexToHash("0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50") // keccak256("eip1967.proxy.beacon") - 1
+	eip1967AdminSlot           = common.HexToHash("0xb53127684a568b3173ae13b9f8a6016e243e63b6e8ee1178d6a717850b5d6103") // keccak256("eip1967.proxy.admin") - 1
+	ozLegacyImplementationSlot = crypto.Keccak256Hash([]byte("org.zeppelinos.proxy.implementation"))
+)
+
+// EIP-1167 最小代理的运行时代码是 prefix + 20 字节逻辑合约地址 + suffix
+var (
+	eip1167Prefix = common.FromHex("0x363d3d373d3d3d363d73")
+	eip1167Suffix = common.FromHex("0x5af43d82803e903d91602b57fd5bf3")
+)
+
+// beaconImplementationSelector beacon 合约的 implementation()
+var beaconImplementationSelector = common.FromHex("0x5c60da1b")
+
+type ProxyKind string
+
+const (
+	ProxyNone     ProxyKind = ""
+	ProxyEIP1967  ProxyKind = "eip1967"        // 实现地址保存在 EIP-1967 implementation 槽
+	ProxyBeacon   ProxyKind = "eip1967-beacon" // EIP-1967 beacon 槽指向 beacon 合约，实现地址由 beacon 返回
+	ProxyEIP1167  ProxyKind = "eip1167"        // 最小代理，实现地址写在代码中
+	ProxyOZLegacy ProxyKind = "oz-legacy"      // EIP-1967 之前 OpenZeppelin (zos) 使用的槽
+)
+
+// ContractInfo 地址上的代码以及代理信息，所有字段读取自同一个区块
+type ContractInfo struct {
+	Address        common.Address
+	IsContract     bool // false 表示外部账户，或者合约还没有部署、已经自毁
+	CodeSize       int
+	CodeHash       common.Hash
+	ProxyKind      ProxyKind
+	Implementation common.Address // 代理指向的逻辑合约，不是代理时为零地址
+	Beacon         common.Address // ProxyBeacon 时的 beacon 合约
+	Admin          common.Address // EIP-1967 admin 槽，没有设置时为零地址
+	Block          BlockRef
+}
+
+func (r *ETHRPCRequester) GetCode(address string) (hexutil.Bytes, error) {
+	return r.GetCodeContext(context.Background(), address)
+}
+
+func (r *ETHRPCRequester) GetCodeContext(ctx context.Context, address string) (hexutil.Bytes, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.getCode(ctx, address, "latest")
+}
+
+func (r *ETHRPCRequester) GetCodeAt(ctx context.Context, address string, block BlockSelector) (hexutil.Bytes, BlockRef, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	ref, param, err := r.resolveBlock(ctx, block)
+	if err != nil {
+		return nil, BlockRef{}, err
+	}
+	code, err := r.getCode(ctx, address, param)
+	return code, ref, err
+}
+
+func (r *ETHRPCRequester) getCode(ctx context.Context, address string, block interface{}) (hexutil.Bytes, error) {
+	if err := r.resolveAddressArgs(ctx, &address); err != nil {
+		return nil, err
+	}
+	code := hexutil.Bytes{}
+	if err := r.client.CallContext(ctx, &code, "eth_getCode", address, block); err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// GetStorageAt 读取合约存储槽，slot 为十六进制的槽位置
+func (r *ETHRPCRequester) GetStorageAt(address, slot string) (common.Hash, error) {
+	return r.GetStorageAtContext(context.Background(), address, slot)
+}
+
+func (r *ETHRPCRequester) GetStorageAtContext(ctx context.Context, address, slot string) (common.Hash, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.getStorageAt(ctx, address, slot, "latest")
+}
+
+// GetStorageAtBlock 读取指定区块的存储槽，同时返回实际读取的区块
+func (r *ETHRPCRequester) GetStorageAtBlock(ctx context.Context, address, slot string, block BlockSelector) (common.Hash, BlockRef, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	ref, param, err := r.resolveBlock(ctx, block)
+	if err != nil {
+		return common.Hash{}, BlockRef{}, err
+	}
+	value, err := r.getStorageAt(ctx, address, slot, param)
+	return value, ref, err
+}
+
+func (r *ETHRPCRequester) getStorageAt(ctx context.Context, address, slot string, block interface{}) (common.Hash, error) {
+	if err := r.resolveAddressArgs(ctx, &address); err != nil {
+		return common.Hash{}, err
+	}
+	value := common.Hash{}
+	if err := r.client.CallContext(ctx, &value, "eth_getStorageAt", address, common.HexToHash(slot), block); err != nil {
+		return common.Hash{}, err
+	}
+	return value, nil
+}
+
+// InspectContract 判断地址是外部账户还是合约，并识别 EIP-1967（implementation、beacon、admin 槽）、
+// EIP-1167 最小代理以及 OpenZeppelin 旧版代理，返回代理指向的逻辑合约
+func (r *ETHRPCRequester) InspectContract(address string) (*ContractInfo, error) {
+	return r.InspectContractAt(context.Background(), address, AtLatest)
+}
+
+func (r *ETHRPCRequester) InspectContractContext(ctx context.Context, address string) (*ContractInfo, error) {
+	return r.InspectContractAt(ctx, address, AtLatest)
+}
+
+func (r *ETHRPCRequester) InspectContractAt(ctx context.Context, address string, block BlockSelector) (*ContractInfo, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	if err := r.resolveAddressArgs(ctx, &address); err != nil {
+		return nil, err
+	}
+	ref, param, err := r.resolveBlock(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+	info := &ContractInfo{Address: common.HexToAddress(address), Block: ref}
+
+	// 代码和所有代理槽在同一个批量请求中读取
+	code := hexutil.Bytes{}
+	slots := []common.Hash{eip1967ImplementationSlot, eip1967BeaconSlot, eip1967AdminSlot, ozLegacyImplementationSlot}
+	values := make([]common.Hash, len(slots))
+	reqs := []rpc.BatchElem{{Method: "eth_getCode", Args: []interface{}{info.Address, param}, Result: &code}}
+	for i, slot := range slots {
+		reqs = append(reqs, rpc.BatchElem{Method: "eth_getStorageAt", Args: []interface{}{info.Address, slot, param}, Result: &values[i]})
+	}
+	if err := r.client.BatchCallContext(ctx, reqs); err != nil {
+		return nil, err
+	}
+	for _, req := range reqs {
+		if req.Error != nil {
+			return nil, fmt.Errorf("%s failed %s", req.Method, req.Error.Error())
+		}
+	}
+	if len(code) == 0 {
+		return info, nil
+	}
+	info.IsContract = true
+	info.CodeSize = len(code)
+	info.CodeHash = crypto.Keccak256Hash(code)
+	info.Admin = common.BytesToAddress(values[2].Bytes())
+
+	switch {
+	case values[0] != (common.Hash{}):
+		info.ProxyKind = ProxyEIP1967
+		info.Implementation = common.BytesToAddress(values[0].Bytes())
+	case values[1] != (common.Hash{}):
+		info.ProxyKind = ProxyBeacon
+		info.Beacon = common.BytesToAddress(values[1].Bytes())
+		result := hexutil.Bytes{}
+		arg := map[string]interface{}{"to": info.Beacon, "data": hexutil.Bytes(beaconImplementationSelector)}
+		if err := r.client.CallContext(ctx, &result, "eth_call", arg, param); err != nil {
+			return nil, fmt.Errorf("beacon %s implementation() failed %s", info.Beacon.Hex(), err.Error())
+		}
+		if len(result) < 32 {
+			return nil, fmt.Errorf("beacon %s returned invalid implementation %s", info.Beacon.Hex(), result)
+		}
+		info.Implementation = common.BytesToAddress(result[:32])
+	case len(code) == len(eip1167Prefix)+common.AddressLength+len(eip1167Suffix) &&
+		bytes.HasPrefix(code, eip1167Prefix) && bytes.HasSuffix(code, eip1167Suffix):
+		info.ProxyKind = ProxyEIP1167
+		info.Implementation = common.BytesToAddress(code[len(eip1167Prefix) : len(eip1167Prefix)+common.AddressLength])
+	case values[3] != (common.Hash{}):
+		info.ProxyKind = ProxyOZLegacy
+		info.Implementation = common.BytesToAddress(values[3].Bytes())
+	}
+	return info, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"eth-relay/model"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	implementationAddress = common.HexToAddress("0x4000000000000000000000000000000000000001")
+	adminAddress          = common.HexToAddress("0x4000000000000000000000000000000000000002")
+	beaconAddress         = common.HexToAddress("0x4000000000000000000000000000000000000003")
+	eip1967Proxy          = common.HexToAddress("0x4000000000000000000000000000000000000011")
+	beaconProxy           = common.HexToAddress("0x4000000000000000000000000000000000000012")
+	minimalProxy          = common.HexToAddress("0x4000000000000000000000000000000000000013")
+	ozLegacyProxy         = common.HexToAddress("0x4000000000000000000000000000000000000014")
+	plainContract         = common.HexToAddress("0x4000000000000000000000000000000000000015")
+)
+
+type proxyService struct{}
+
+func (s *proxyService) GetBlockByNumber(tag string, full bool) model.Header {
+	return model.Header{Number: "0x10", Hash: "0x00000000000000000000000000000000000000000000000000000000000000aa"}
+}
+
+func (s *proxyService) GetCode(address common.Address, block interface{}) hexutil.Bytes {
+	switch address {
+	case eip1967Proxy, beaconProxy, ozLegacyProxy, plainContract, beaconAddress:
+		return common.FromHex("0x6080604052")
+	case minimalProxy:
+		return append(append(append([]byte{}, eip1167Prefix...), implementationAddress.Bytes()...), eip1167Suffix...)
+	}
+	return hexutil.Bytes{}
+}
+
+func (s *proxyService) GetStorageAt(address common.Address, slot common.Hash, block interface{}) common.Hash {
+	switch {
+	case address == eip1967Proxy && slot == eip1967ImplementationSlot:
+		return common.BytesToHash(implementationAddress.Bytes())
+	case address == eip1967Proxy && slot == eip1967AdminSlot:
+		return common.BytesToHash(adminAddress.Bytes())
+	case address == beaconProxy && slot == eip1967BeaconSlot:
+		return common.BytesToHash(beaconAddress.Bytes())
+	case address == ozLegacyProxy && slot == ozLegacyImplementationSlot:
+		return common.BytesToHash(implementationAddress.Bytes())
+	}
+	return common.Hash{}
+}
+
+func (s *proxyService) Call(arg map[string]interface{}, block interface{}) hexutil.Bytes {
+	if common.HexToAddress(arg["to"].(string)) == beaconAddress {
+		return common.BytesToHash(implementationAddress.Bytes()).Bytes()
+	}
+	return hexutil.Bytes{}
+}
+
+func TestETHRPCRequester_InspectContract(t *testing.T) {
+	requester := newFakeRequester(t, "eth", &proxyService{}, nil)
+
+	cases := []struct {
+		address        common.Address
+		isContract     bool
+		kind           ProxyKind
+		implementation common.Address
+	}{
+		{common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"), false, ProxyNone, common.Address{}},
+		{plainContract, true, ProxyNone, common.Address{}},
+		{eip1967Proxy, true, ProxyEIP1967, implementationAddress},
+		{beaconProxy, true, ProxyBeacon, implementationAddress},
+		{minimalProxy, true, ProxyEIP1167, implementationAddress},
+		{ozLegacyProxy, true, ProxyOZLegacy, implementationAddress},
+	}
+	for _, c := range cases {
+		info, err := requester.InspectContract(c.address.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.IsContract != c.isContract || info.ProxyKind != c.kind || info.Implementation != c.implementation {
+			t.Fatalf("%s: unexpected info %+v", c.address.Hex(), info)
+		}
+		if info.Block.Number.Int64() != 0x10 {
+			t.Fatalf("unexpected block %+v", info.Block)
+		}
+	}
+
+	info, err := requester.InspectContract(eip1967Proxy.Hex())
+	if err != nil || info.Admin != adminAddress {
+		t.Fatalf("unexpected admin %+v %v", info, err)
+	}
+	info, err = requester.InspectContract(beaconProxy.Hex())
+	if err != nil || info.Beacon != beaconAddress {
+		t.Fatalf("unexpected beacon %+v %v", info, err)
+	}
+
+	value, err := requester.GetStorageAt(eip1967Proxy.Hex(), eip1967ImplementationSlot.Hex())
+	if err != nil || common.BytesToAddress(value.Bytes()) != implementationAddress {
+		t.Fatalf("unexpected storage %s %v", value.Hex(), err)
+	}
+	code, err := requester.GetCode(minimalProxy.Hex())
+	if err != nil || len(code) != 45 {
+		t.Fatalf("unexpected code %s %v", code, err)
+	}
+}
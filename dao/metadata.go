@@ -0,0 +1,8 @@
+package dao
+
+// Metadata 保存索引数据所属链等全局信息，Name 唯一
+type Metadata struct {
+	Id    int64  `json:"id"`                        // 主键
+	Name  string `xorm:"unique" json:"name"`        // 键名，比如 chain_id、genesis_hash
+	Value string `xorm:"varchar(255)" json:"value"` // 键值
+}
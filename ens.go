@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"eth-relay/tool"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// DefaultENSRegistry 主网和各测试网上 ENS registry 的地址
+const DefaultENSRegistry = "0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e"
+
+const ensAbi = `[
+	{"type":"function","name":"resolver","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"addr","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"name","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"string"}]}
+]`
+
+var ensParsedAbi, _ = tool.ParseABI(ensAbi)
+
+var (
+	ErrENSNotFound       = errors.New("ens name not found")
+	ErrENSReverseInvalid = errors.New("ens reverse record does not resolve back to the address")
+)
+
+type ENSOptions struct {
+	Registry string        // ENS registry 地址，默认 DefaultENSRegistry
+	CacheTTL time.Duration // 解析结果的缓存时间，默认 5 分钟
+}
+
+type ensEntry struct {
+	value   string
+	expires time.Time
+}
+
+// ensResolver 正向解析的 key 为 "name:" + 名字，反向解析的 key 为 "addr:" + 小写地址
+type ensResolver struct {
+	options  ENSOptions
+	registry common.Address
+	lock     sync.Mutex
+	entries  map[string]ensEntry
+}
+
+func newENSResolver(options *ENSOptions) *ensResolver {
+	e := &ensResolver{lock: sync.Mutex{}, entries: make(map[string]ensEntry)}
+	if options != nil {
+		e.options = *options
+	}
+	if e.options.Registry == "" {
+		e.options.Registry = DefaultENSRegistry
+	}
+	if e.options.CacheTTL == 0 {
+		e.options.CacheTTL = 5 * time.Minute
+	}
+	e.registry = common.HexToAddress(e.options.Registry)
+	return e
+}
+
+func (e *ensResolver) get(key string) (string, bool) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	entry, ok := e.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		delete(e.entries, key)
+		return "", false
+	}
+	return entry.value, true
+}
+
+func (e *ensResolver) put(key, value string) {
+	e.lock.Lock()
+	e.entries[key] = ensEntry{value: value, expires: time.Now().Add(e.options.CacheTTL)}
+	e.lock.Unlock()
+}
+
+// NameHash EIP-137 namehash。名字只做小写处理，没有实现完整的 ENSIP-15 规范化
+func NameHash(name string) common.Hash {
+	node := common.Hash{}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		node = crypto.Keccak256Hash(node.Bytes(), crypto.Keccak256([]byte(labels[i])))
+	}
+	return node
+}
+
+// isENSName 不是十六进制地址，并且像 alice.eth 这样至少有两段
+func isENSName(name string) bool {
+	if common.IsHexAddress(name) || strings.ContainsAny(name, " \t\n") {
+		return false
+	}
+	labels := strings.Split(name, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolveName 通过 ENS registry 找到名字的 resolver，再查询 addr(node)
+func (r *ETHRPCRequester) ResolveName(name string) (common.Address, error) {
+	return r.ResolveNameContext(context.Background(), name)
+}
+
+func (r *ETHRPCRequester) ResolveNameContext(ctx context.Context, name string) (common.Address, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.resolveName(ctx, name)
+}
+
+func (r *ETHRPCRequester) resolveName(ctx context.Context, name string) (common.Address, error) {
+	if !isENSName(name) {
+		return common.Address{}, fmt.Errorf("invalid ens name %q", name)
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if address, ok := r.ens.get("name:" + name); ok {
+		return common.HexToAddress(address), nil
+	}
+	node := NameHash(name)
+	resolver, err := r.ensResolverOf(ctx, node)
+	if err != nil {
+		return common.Address{}, err
+	}
+	address := common.Address{}
+	if err := r.ensCaller(resolver).Call(ctx, &address, "addr", node); err != nil {
+		return common.Address{}, fmt.Errorf("ens addr of %s failed %w", name, err)
+	}
+	if address == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("%w: %s has no address", ErrENSNotFound, name)
+	}
+	r.ens.put("name:"+name, address.Hex())
+	return address, nil
+}
+
+// LookupAddress 反向解析地址的主名字，并且只在该名字正向解析回同一个地址时返回，防止伪造的反向记录
+func (r *ETHRPCRequester) LookupAddress(address string) (string, error) {
+	return r.LookupAddressContext(context.Background(), address)
+}
+
+func (r *ETHRPCRequester) LookupAddressContext(ctx context.Context, address string) (string, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	if !common.IsHexAddress(address) {
+		return "", fmt.Errorf("invalid address %s", address)
+	}
+	_address := common.HexToAddress(address)
+	key := "addr:" + strings.ToLower(_address.Hex())
+	if name, ok := r.ens.get(key); ok {
+		return name, nil
+	}
+	node := NameHash(strings.ToLower(_address.Hex()[2:]) + ".addr.reverse")
+	resolver, err := r.ensResolverOf(ctx, node)
+	if err != nil {
+		return "", err
+	}
+	name := ""
+	if err := r.ensCaller(resolver).Call(ctx, &name, "name", node); err != nil {
+		return "", fmt.Errorf("ens name of %s failed %w", _address.Hex(), err)
+	}
+	if name == "" {
+		return "", fmt.Errorf("%w: %s has no reverse record", ErrENSNotFound, _address.Hex())
+	}
+	// 只有确定名字不存在时才算反向记录无效，超时等错误直接返回
+	forward, err := r.resolveName(ctx, name)
+	if err != nil && !errors.Is(err, ErrENSNotFound) {
+		return "", err
+	}
+	if forward != _address {
+		return "", fmt.Errorf("%w: %s -> %s -> %s", ErrENSReverseInvalid, _address.Hex(), name, forward.Hex())
+	}
+	r.ens.put(key, name)
+	return name, nil
+}
+
+func (r *ETHRPCRequester) ensResolverOf(ctx context.Context, node common.Hash) (common.Address, error) {
+	resolver := common.Address{}
+	if err := r.ensCaller(r.ens.registry).Call(ctx, &resolver, "resolver", node); err != nil {
+		var revertErr *ExecutionRevertedError
+		if errors.Is(err, ErrEmptyCallResult) || errors.As(err, &revertErr) {
+			// registry 没有部署时返回空数据
+			return common.Address{}, fmt.Errorf("%w: ens registry %s unavailable %s", ErrENSNotFound, r.ens.registry.Hex(), err.Error())
+		}
+		// 网络错误、超时等不能说明名字不存在
+		return common.Address{}, fmt.Errorf("ens resolver of %s failed %w", node.Hex(), err)
+	}
+	if resolver == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("%w: no resolver for node %s", ErrENSNotFound, node.Hex())
+	}
+	return resolver, nil
+}
+
+func (r *ETHRPCRequester) ensCaller(address common.Address) *ContractCaller {
+	return &ContractCaller{requester: r, address: address, abiStr: ensAbi, abi: ensParsedAbi}
+}
+
+// resolveAddress 地址参数可以是十六进制地址或者 ENS 名字，统一返回十六进制地址
+func (r *ETHRPCRequester) resolveAddress(ctx context.Context, address string) (string, error) {
+	if common.IsHexAddress(address) {
+		return address, nil
+	}
+	if !isENSName(address) {
+		return "", fmt.Errorf("invalid address %q", address)
+	}
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	resolved, err := r.resolveName(ctx, address)
+	if err != nil {
+		return "", err
+	}
+	return resolved.Hex(), nil
+}
+
+// resolveAddressArgs 原地把参数中的 ENS 名字替换成地址，任意一个参数不合法时返回错误。
+// 批量请求中把返回的错误放到对应元素的 BatchResult 中
+func (r *ETHRPCRequester) resolveAddressArgs(ctx context.Context, addresses ...*string) error {
+	for _, address := range addresses {
+		resolved, err := r.resolveAddress(ctx, *address)
+		if err != nil {
+			return err
+		}
+		*address = resolved
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	ensResolverAddress = common.HexToAddress("0x3000000000000000000000000000000000000001")
+	aliceAddress       = common.HexToAddress("0x3000000000000000000000000000000000000a11")
+	bobAddress         = common.HexToAddress("0x3000000000000000000000000000000000000b0b")
+)
+
+// ensService alice.eth 指向 aliceAddress；alice 和 bob 的反向记录都是 alice.eth，bob 的是伪造的
+type ensService struct {
+	calls       atomic.Int64
+	failForward atomic.Bool // 为 true 时查询 alice.eth 的 resolver 返回节点错误，模拟超时
+}
+
+func (s *ensService) Call(arg map[string]interface{}, block interface{}) (hexutil.Bytes, error) {
+	s.calls.Add(1)
+	to := common.HexToAddress(arg["to"].(string))
+	data := common.FromHex(arg["data"].(string))
+	method, err := ensParsedAbi.MethodById(data[:4])
+	if err != nil {
+		return hexutil.Bytes{}, nil
+	}
+	node := common.BytesToHash(data[4:36])
+	if s.failForward.Load() && node == NameHash("alice.eth") {
+		return nil, errors.New("upstream request timeout")
+	}
+	known := node == NameHash("alice.eth") ||
+		node == NameHash(strings.ToLower(aliceAddress.Hex()[2:])+".addr.reverse") ||
+		node == NameHash(strings.ToLower(bobAddress.Hex()[2:])+".addr.reverse")
+	switch {
+	case to == common.HexToAddress(DefaultENSRegistry) && method.Name == "resolver":
+		if known {
+			return method.Outputs.Pack(ensResolverAddress)
+		}
+		return method.Outputs.Pack(common.Address{})
+	case to == ensResolverAddress && method.Name == "addr":
+		return method.Outputs.Pack(aliceAddress)
+	case to == ensResolverAddress && method.Name == "name":
+		return method.Outputs.Pack("alice.eth")
+	}
+	return hexutil.Bytes{}, nil
+}
+
+func (s *ensService) GetBalance(address common.Address, block string) (string, error) {
+	if address != aliceAddress {
+		return "0x0", nil
+	}
+	return "0x64", nil
+}
+
+func TestNameHash(t *testing.T) {
+	if NameHash("") != (common.Hash{}) {
+		t.Fatal("namehash of empty name should be zero")
+	}
+	if NameHash("eth").Hex() != "0x93cdeb708b7545dc668eb9280176169d1c33cfd8ed6f04690a0bcc88a93fc4ae" {
+		t.Fatalf("unexpected namehash %s", NameHash("eth").Hex())
+	}
+	if NameHash("foo.eth").Hex() != "0xde9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f" {
+		t.Fatalf("unexpected namehash %s", NameHash("foo.eth").Hex())
+	}
+	if NameHash("Foo.ETH") != NameHash("foo.eth") {
+		t.Fatal("namehash should be case insensitive")
+	}
+}
+
+func TestETHRPCRequester_ResolveName(t *testing.T) {
+	service := &ensService{}
+	requester := newFakeRequester(t, "eth", service, nil)
+	address, err := requester.ResolveName("Alice.eth")
+	if err != nil || address != aliceAddress {
+		t.Fatalf("unexpected address %s %v", address.Hex(), err)
+	}
+	// 第二次从缓存读取
+	calls := service.calls.Load()
+	if _, err := requester.ResolveName("alice.eth"); err != nil || service.calls.Load() != calls {
+		t.Fatalf("expected cached resolution, err %v", err)
+	}
+	if _, err := requester.ResolveName("nobody.eth"); !errors.Is(err, ErrENSNotFound) {
+		t.Fatalf("expected ErrENSNotFound, got %v", err)
+	}
+
+	// 地址参数可以是 ENS 名字
+	balance, err := requester.GetETHBalance("alice.eth")
+	if err != nil || balance != "100" {
+		t.Fatalf("unexpected balance %s %v", balance, err)
+	}
+	if _, err := requester.GetETHBalance("not-an-address"); err == nil {
+		t.Fatal("expected error for invalid address")
+	}
+}
+
+func TestETHRPCRequester_LookupAddress(t *testing.T) {
+	requester := newFakeRequester(t, "eth", &ensService{}, nil)
+	name, err := requester.LookupAddress(aliceAddress.Hex())
+	if err != nil || name != "alice.eth" {
+		t.Fatalf("unexpected name %s %v", name, err)
+	}
+	// bob 的反向记录指向 alice.eth，正向解析不一致
+	if _, err := requester.LookupAddress(bobAddress.Hex()); !errors.Is(err, ErrENSReverseInvalid) {
+		t.Fatalf("expected ErrENSReverseInvalid, got %v", err)
+	}
+	if _, err := requester.LookupAddress(common.Address{}.Hex()); !errors.Is(err, ErrENSNotFound) {
+		t.Fatalf("expected ErrENSNotFound, got %v", err)
+	}
+}
+
+func TestETHRPCRequester_ENSTransientError(t *testing.T) {
+	service := &ensService{}
+	service.failForward.Store(true)
+	requester := newFakeRequester(t, "eth", service, nil)
+	// 正向校验时节点出错，不能当作反向记录无效
+	_, err := requester.LookupAddress(aliceAddress.Hex())
+	if err == nil || errors.Is(err, ErrENSReverseInvalid) || errors.Is(err, ErrENSNotFound) {
+		t.Fatalf("expected transient error, got %v", err)
+	}
+
+	// 批量请求中解析失败的名字，错误放在对应元素上
+	service.failForward.Store(false)
+	balances, err := requester.GetEthBalances([]string{"nobody.eth", "alice.eth"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(balances[0].Err, ErrENSNotFound) || balances[1].Err != nil || balances[1].Value != "100" {
+		t.Fatalf("unexpected balances %+v", balances)
+	}
+}
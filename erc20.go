@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"eth-relay/tool"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ERC20Abi 查询和转账用到的 ERC-20 标准方法
+const ERC20Abi = `[
+	{"type":"function","name":"name","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"symbol","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"decimals","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint8"}]},
+	{"type":"function","name":"totalSupply","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"allowance","stateMutability":"view","inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"transfer","stateMutability":"nonpayable","inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]}
+]`
+
+var erc20Abi, _ = tool.ParseABI(ERC20Abi)
+
+// TokenMetadata 代币不会变化的信息，查询一次之后缓存
+type TokenMetadata struct {
+	Address  string `json:"address"`
+	Name     string `json:"name"`   // 合约没有实现 name 时为空
+	Symbol   string `json:"symbol"` // 合约没有实现 symbol 时为空
+	Decimals uint8  `json:"decimals"`
+}
+
+type AllowanceRpcReq struct {
+	ContractAddress string // 合约的以太坊地址
+	Owner           string // 授权人
+	Spender         string // 被授权人
+}
+
+// tokenCache 内存中的代币信息，开启 ResponseCache 时同时写入缓存，配置了 DiskDir 时重启后仍然有效
+type tokenCache struct {
+	lock      sync.Mutex
+	tokens    map[common.Address]TokenMetadata
+	standards map[common.Address]TokenStandard // 只在内存中缓存
+}
+
+// tokenCall 对某个合约的一次 eth_call
+type tokenCall struct {
+	to   common.Address
+	data []byte
+	err  error // 参数不合法（比如 ENS 名字解析失败）时的错误，不发送请求
+}
+
+// GetTokenMetadata 批量查询代币的 name、symbol 和 decimals，结果与 contracts 按下标一一对应。
+// 没有实现 decimals 的合约返回错误，name 和 symbol 兼容返回 bytes32 或者不返回数据的合约
+func (r *ETHRPCRequester) GetTokenMetadata(contracts []string) ([]BatchResult[TokenMetadata], error) {
+	return r.GetTokenMetadataContext(context.Background(), contracts)
+}
+
+func (r *ETHRPCRequester) GetTokenMetadataContext(ctx context.Context, contracts []string) ([]BatchResult[TokenMetadata], error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	return r.getTokenMetadata(ctx, contracts)
+}
+
+func (r *ETHRPCRequester) getTokenMetadata(ctx context.Context, contracts []string) ([]BatchResult[TokenMetadata], error) {
+	finalRes := make([]BatchResult[TokenMetadata], len(contracts))
+	var calls []tokenCall
+	var missing []common.Address // 需要查询的合约，每个对应 calls 中连续的 3 个请求
+	pending := make(map[common.Address][]int)
+	for i, contract := range contracts {
+		if err := r.resolveAddressArgs(ctx, &contract); err != nil {
+			finalRes[i].Err = fmt.Errorf("invalid contract address %w", err)
+			continue
+		}
+		address := common.HexToAddress(contract)
+		if metadata, ok := r.cachedToken(address); ok {
+			finalRes[i].Value = metadata
+			continue
+		}
+		if _, ok := pending[address]; !ok {
+			missing = append(missing, address)
+			for _, method := range []string{"name", "symbol", "decimals"} {
+				data, _ := erc20Abi.Pack(method)
+				calls = append(calls, tokenCall{to: address, data: data})
+			}
+		}
+		pending[address] = append(pending[address], i)
+	}
+	if len(calls) == 0 {
+		return finalRes, nil
+	}
+	results, err := r.batchTokenCall(ctx, calls, "latest")
+	if err != nil {
+		return nil, err
+	}
+	for j, address := range missing {
+		name, symbol, decimals := results[3*j], results[3*j+1], results[3*j+2]
+		metadata := TokenMetadata{Address: address.Hex()}
+		err := decimals.Err
+		if err == nil {
+			metadata.Decimals, err = decodeDecimals(decimals.Value)
+		}
+		if err == nil {
+			// name 和 symbol 是可选的，调用失败时留空
+			metadata.Name = decodeTokenString("name", name.Value)
+			metadata.Symbol = decodeTokenString("symbol", symbol.Value)
+			r.cacheToken(address, metadata)
+		} else {
+			err = fmt.Errorf("token %s decimals failed %s", address.Hex(), err.Error())
+		}
+		for _, i := range pending[address] {
+			finalRes[i].Value, finalRes[i].Err = metadata, err
+		}
+	}
+	return finalRes, nil
+}
+
+// GetTotalSupplies 批量查询代币的发行量，按代币的 decimals 格式化
+func (r *ETHRPCRequester) GetTotalSupplies(contracts []string) ([]BatchResult[string], error) {
+	return r.GetTotalSuppliesContext(context.Background(), contracts)
+}
+
+func (r *ETHRPCRequester) GetTotalSuppliesContext(ctx context.Context, contracts []string) ([]BatchResult[string], error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	return r.getTotalSupplies(ctx, contracts, "latest")
+}
+
+func (r *ETHRPCRequester) GetTotalSuppliesAt(ctx context.Context, contracts []string, block BlockSelector) ([]BatchResult[string], BlockRef, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	ref, param, err := r.resolveBlock(ctx, block)
+	if err != nil {
+		return nil, BlockRef{}, err
+	}
+	res, err := r.getTotalSupplies(ctx, contracts, param)
+	return res, ref, err
+}
+
+func (r *ETHRPCRequester) getTotalSupplies(ctx context.Context, contracts []string, block interface{}) ([]BatchResult[string], error) {
+	contracts = append([]string{}, contracts...)
+	calls := make([]*tokenCall, len(contracts))
+	for i, contract := range contracts {
+		if err := r.resolveAddressArgs(ctx, &contract); err != nil {
+			calls[i] = &tokenCall{err: err}
+			continue
+		}
+		contracts[i] = contract
+		data, _ := erc20Abi.Pack("totalSupply")
+		calls[i] = &tokenCall{to: common.HexToAddress(contract), data: data}
+	}
+	return r.getTokenAmounts(ctx, "totalSupply", contracts, calls, nil, block)
+}
+
+// GetAllowances 批量查询 allowance(owner, spender)，按代币的 decimals 格式化
+func (r *ETHRPCRequester) GetAllowances(paramArr []AllowanceRpcReq) ([]BatchResult[string], error) {
+	return r.GetAllowancesContext(context.Background(), paramArr)
+}
+
+func (r *ETHRPCRequester) GetAllowancesContext(ctx context.Context, paramArr []AllowanceRpcReq) ([]BatchResult[string], error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	return r.getAllowances(ctx, paramArr, "latest")
+}
+
+func (r *ETHRPCRequester) GetAllowancesAt(ctx context.Context, paramArr []AllowanceRpcReq, block BlockSelector) ([]BatchResult[string], BlockRef, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	ref, param, err := r.resolveBlock(ctx, block)
+	if err != nil {
+		return nil, BlockRef{}, err
+	}
+	res, err := r.getAllowances(ctx, paramArr, param)
+	return res, ref, err
+}
+
+func (r *ETHRPCRequester) getAllowances(ctx context.Context, paramArr []AllowanceRpcReq, block interface{}) ([]BatchResult[string], error) {
+	contracts := make([]string, len(paramArr))
+	calls := make([]*tokenCall, len(paramArr))
+	for i, param := range paramArr {
+		if err := r.resolveAddressArgs(ctx, &param.ContractAddress, &param.Owner, &param.Spender); err != nil {
+			calls[i] = &tokenCall{err: err}
+			continue
+		}
+		contracts[i] = param.ContractAddress
+		data, _ := erc20Abi.Pack("allowance", common.HexToAddress(param.Owner), common.HexToAddress(param.Spender))
+		calls[i] = &tokenCall{to: common.HexToAddress(param.ContractAddress), data: data}
+	}
+	return r.getTokenAmounts(ctx, "allowance", contracts, calls, nil, block)
+}
+
+// getTokenAmounts 批量执行返回 uint256 的调用，并按 contracts 中代币的 decimals 格式化。
+// calls 中为 nil 的元素表示参数不合法；fallbackDecimals 不为 nil 时，查询不到 decimals 的代币使用其中的数位
+func (r *ETHRPCRequester) getTokenAmounts(ctx context.Context, method string, contracts []string, calls []*tokenCall,
+	fallbackDecimals []int, block interface{}) ([]BatchResult[string], error) {
+	finalRes := make([]BatchResult[string], len(calls))
+	var valid []tokenCall
+	var indexes []int // valid 中每个请求对应 calls 的下标
+	for i, call := range calls {
+		if call == nil {
+			finalRes[i].Err = fmt.Errorf("invalid address in %s request %d", method, i)
+			continue
+		}
+		if call.err != nil {
+			finalRes[i].Err = call.err
+			continue
+		}
+		valid = append(valid, *call)
+		indexes = append(indexes, i)
+	}
+	if len(valid) == 0 {
+		return finalRes, nil
+	}
+	results, err := r.batchTokenCall(ctx, valid, block)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []string
+	for _, i := range indexes {
+		tokens = append(tokens, contracts[i])
+	}
+	metadata, err := r.getTokenMetadata(ctx, tokens)
+	if err != nil {
+		return nil, err
+	}
+	for j, result := range results {
+		i := indexes[j]
+		if result.Err != nil {
+			finalRes[i].Err = result.Err
+			continue
+		}
+		if len(result.Value) == 0 {
+			// 地址不是合约，或者合约没有这个方法
+			finalRes[i].Err = fmt.Errorf("contract %s returned empty result for %s", contracts[i], method)
+			continue
+		}
+		values, err := erc20Abi.Unpack(method, result.Value)
+		if err != nil {
+			finalRes[i].Err = fmt.Errorf("unpack %s failed %s", method, err.Error())
+			continue
+		}
+		decimals := int(metadata[j].Value.Decimals)
+		if metadata[j].Err != nil {
+			if fallbackDecimals == nil {
+				finalRes[i].Err = metadata[j].Err
+				continue
+			}
+			decimals = fallbackDecimals[i]
+		}
+		finalRes[i].Value = tool.FormatDecimalValue(values[0].(*big.Int), decimals)
+	}
+	return finalRes, nil
+}
+
+// tokenDecimals 发送代币时换算金额使用的数位，decimal 不小于 0 时直接使用
+func (r *ETHRPCRequester) tokenDecimals(ctx context.Context, contract string, decimal int) (int, error) {
+	if decimal >= 0 {
+		return decimal, nil
+	}
+	res, err := r.getTokenMetadata(ctx, []string{contract})
+	if err != nil {
+		return 0, err
+	}
+	if res[0].Err != nil {
+		return 0, res[0].Err
+	}
+	return int(res[0].Value.Decimals), nil
+}
+
+// batchTokenCall 执行多个 eth_call，返回原始的返回数据。开启 Multicall 时通过 aggregate3 发送
+func (r *ETHRPCRequester) batchTokenCall(ctx context.Context, calls []tokenCall, block interface{}) ([]BatchResult[hexutil.Bytes], error) {
+	if r.multicaller.aggregate {
+		allowFailure := make([]bool, len(calls))
+		for i := range allowFailure {
+			allowFailure[i] = true
+		}
+		return r.multicall(ctx, calls, allowFailure, block)
+	}
+	return r.plainBatchCall(ctx, calls, block)
+}
+
+// plainBatchCall 一次批量请求执行多个 eth_call，每个调用是一个 JSON-RPC 请求
+func (r *ETHRPCRequester) plainBatchCall(ctx context.Context, calls []tokenCall, block interface{}) ([]BatchResult[hexutil.Bytes], error) {
+	reqs := make([]rpc.BatchElem, len(calls))
+	resArr := make([]hexutil.Bytes, len(calls))
+	for i, call := range calls {
+		arg := map[string]interface{}{"to": call.to, "data": hexutil.Bytes(call.data)}
+		reqs[i] = rpc.BatchElem{Method: "eth_call", Args: []interface{}{arg, block}, Result: &resArr[i]}
+	}
+	if err := r.client.BatchCallContext(ctx, reqs); err != nil {
+		return nil, err
+	}
+	finalRes := make([]BatchResult[hexutil.Bytes], len(calls))
+	for i, req := range reqs {
+		finalRes[i].Value, finalRes[i].Err = resArr[i], req.Error
+	}
+	return finalRes, nil
+}
+
+func (r *ETHRPCRequester) cachedToken(address common.Address) (TokenMetadata, bool) {
+	r.tokens.lock.Lock()
+	metadata, ok := r.tokens.tokens[address]
+	r.tokens.lock.Unlock()
+	if ok {
+		return metadata, true
+	}
+	if r.cache != nil && r.cache.Get(tokenKey(address.Hex()), &metadata) {
+		r.tokens.lock.Lock()
+		r.tokens.tokens[address] = metadata
+		r.tokens.lock.Unlock()
+		return metadata, true
+	}
+	return TokenMetadata{}, false
+}
+
+func (r *ETHRPCRequester) cacheToken(address common.Address, metadata TokenMetadata) {
+	r.tokens.lock.Lock()
+	r.tokens.tokens[address] = metadata
+	r.tokens.lock.Unlock()
+	if r.cache != nil {
+		// 代币信息不属于某个区块，不会因为回滚失效
+		r.cache.Put(tokenKey(address.Hex()), "", metadata)
+	}
+}
+
+func decodeDecimals(data []byte) (uint8, error) {
+	if len(data) == 0 {
+		return 0, fmt.Errorf("empty result")
+	}
+	// 部分代币的 decimals 返回 uint256
+	decimals := new(big.Int).SetBytes(data[:min(len(data), 32)])
+	if decimals.Cmp(big.NewInt(255)) > 0 {
+		return 0, fmt.Errorf("invalid decimals %s", decimals)
+	}
+	return uint8(decimals.Uint64()), nil
+}
+
+// decodeTokenString 解析 name、symbol，早期的代币（比如 MKR）返回 bytes32
+func decodeTokenString(method string, data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	if values, err := erc20Abi.Unpack(method, data); err == nil {
+		return values[0].(string)
+	}
+	if len(data) == 32 {
+		return strings.TrimSpace(string(bytes.TrimRight(data, "\x00")))
+	}
+	return ""
+}
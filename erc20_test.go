@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	standardToken = common.HexToAddress("0x1000000000000000000000000000000000000001") // decimals 6
+	bytes32Token  = common.HexToAddress("0x1000000000000000000000000000000000000002") // name、symbol 返回 bytes32
+	bareToken     = common.HexToAddress("0x1000000000000000000000000000000000000003") // 只实现了 balanceOf
+)
+
+type erc20Service struct {
+	calls     atomic.Int64
+	blockHash atomic.Value // 最近一次按区块 hash 调用时的 hash
+}
+
+// GetBlockByNumber 任何区块号或者标签都返回 16 号区块，用于测试 *At 方法
+func (s *erc20Service) GetBlockByNumber(number string, full bool) map[string]string {
+	return map[string]string{"number": "0x10", "hash": "0x00000000000000000000000000000000000000000000000000000000000000aa"}
+}
+
+func (s *erc20Service) Call(arg map[string]interface{}, block interface{}) (hexutil.Bytes, error) {
+	s.calls.Add(1)
+	if selector, ok := block.(map[string]interface{}); ok {
+		s.blockHash.Store(selector["blockHash"].(string))
+	}
+	to := common.HexToAddress(arg["to"].(string))
+	data := common.FromHex(arg["data"].(string))
+	method, err := erc20Abi.MethodById(data[:4])
+	if err != nil {
+		return hexutil.Bytes{}, nil
+	}
+	switch {
+	case method.Name == "balanceOf" || method.Name == "totalSupply" || method.Name == "allowance":
+		return method.Outputs.Pack(big.NewInt(1500000))
+	case to == bareToken:
+		return hexutil.Bytes{}, nil
+	case method.Name == "decimals":
+		return method.Outputs.Pack(uint8(6))
+	case to == bytes32Token:
+		word := common.RightPadBytes([]byte("Maker"), 32)
+		if method.Name == "symbol" {
+			word = common.RightPadBytes([]byte("MKR"), 32)
+		}
+		return word, nil
+	}
+	return method.Outputs.Pack("Test " + method.Name)
+}
+
+func TestETHRPCRequester_GetTokenMetadata(t *testing.T) {
+	service := &erc20Service{}
+	requester := newFakeRequester(t, "eth", service, nil)
+	contracts := []string{standardToken.Hex(), bytes32Token.Hex(), bareToken.Hex(), standardToken.Hex()}
+	res, err := requester.GetTokenMetadata(contracts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[0].Err != nil || res[0].Value.Name != "Test name" || res[0].Value.Symbol != "Test symbol" || res[0].Value.Decimals != 6 {
+		t.Fatalf("unexpected standard token %+v %v", res[0].Value, res[0].Err)
+	}
+	if res[1].Err != nil || res[1].Value.Name != "Maker" || res[1].Value.Symbol != "MKR" {
+		t.Fatalf("unexpected bytes32 token %+v %v", res[1].Value, res[1].Err)
+	}
+	if res[2].Err == nil {
+		t.Fatal("expected error for token without decimals")
+	}
+	if res[3].Value != res[0].Value {
+		t.Fatalf("duplicate contract returned %+v", res[3].Value)
+	}
+	// 重复的合约只查询一次
+	if service.calls.Load() != 9 {
+		t.Fatalf("expected 9 eth_call, got %d", service.calls.Load())
+	}
+
+	// 第二次从缓存读取
+	if _, err := requester.GetTokenMetadata(contracts[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if service.calls.Load() != 9 {
+		t.Fatalf("expected cached metadata, got %d eth_call", service.calls.Load())
+	}
+}
+
+func TestETHRPCRequester_GetERC20BalancesFormatted(t *testing.T) {
+	service := &erc20Service{}
+	requester := newFakeRequester(t, "eth", service, nil)
+	user := "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"
+	res, err := requester.GetERC20BalancesContext(context.Background(), []ERC20BalanceRpcReq{
+		{ContractAddress: standardToken.Hex(), UserAddress: user},
+		{ContractAddress: bareToken.Hex(), UserAddress: user, ContractDecimal: 2},
+		{ContractAddress: "bad", UserAddress: user},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有 decimals 的代币使用 ContractDecimal
+	if res[0].Value != "1.5" || res[1].Value != "15000" || res[2].Err == nil {
+		t.Fatalf("unexpected balances %+v", res)
+	}
+
+	allowances, err := requester.GetAllowances([]AllowanceRpcReq{{ContractAddress: standardToken.Hex(), Owner: user, Spender: user}})
+	if err != nil || allowances[0].Value != "1.5" {
+		t.Fatalf("unexpected allowance %+v %v", allowances, err)
+	}
+	supplies, err := requester.GetTotalSupplies([]string{standardToken.Hex(), bareToken.Hex()})
+	if err != nil || supplies[0].Value != "1.5" || supplies[1].Err == nil {
+		t.Fatalf("unexpected total supply %+v %v", supplies, err)
+	}
+
+	// 指定区块时按该区块的 hash 读取
+	supplies, ref, err := requester.GetTotalSuppliesAt(context.Background(), []string{standardToken.Hex()}, AtBlockNumber(big.NewInt(16)))
+	if err != nil || supplies[0].Value != "1.5" || ref.Number.Int64() != 16 || service.blockHash.Load() != ref.Hash {
+		t.Fatalf("unexpected total supply %+v %+v %v", supplies, ref, err)
+	}
+	allowances, ref, err = requester.GetAllowancesAt(context.Background(),
+		[]AllowanceRpcReq{{ContractAddress: standardToken.Hex(), Owner: user, Spender: user}}, AtLatest)
+	if err != nil || allowances[0].Value != "1.5" || ref.Hash == "" {
+		t.Fatalf("unexpected allowance %+v %+v %v", allowances, ref, err)
+	}
+}
@@ -1,79 +1,353 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"eth-relay/model"
 	"eth-relay/tool"
 	"fmt"
+	"io"
 	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 const localUrl = "http://localhost:8545"
 const sepoliaUrl = "https://sepolia.infura.io/v3/123"
+const localWsUrl = "ws://localhost:8545"
+
+// 录制 fixture 时本地节点上已经存在的两笔转账
+const fixtureTxHash1 = "0x7d10d7a4d689f1f40358b651b473966b61b1d7c70a0224df01cb9b77f6977fb2"
+const fixtureTxHash2 = "0x587416726e49aa3ccf6ad5d6d36a5049ecaff8539ac2a6522f43ef881c15428a"
+
+// newTestRequester 默认从 testdata/fixtures 回放录制好的响应，不访问网络；
+// 设置 ETH_RPC_RECORD=1 时请求 nodeUrl 并重新录制。没有 fixture 的测试会被跳过
+func newTestRequester(t *testing.T, nodeUrl string) *ETHRPCRequester {
+	path := filepath.Join("testdata", "fixtures", t.Name()+".json")
+	mode := FixtureReplay
+	if os.Getenv("ETH_RPC_RECORD") != "" {
+		mode = FixtureRecord
+		_ = os.Remove(path)
+	} else if _, err := os.Stat(path); err != nil {
+		t.Skipf("fixture %s not found, run with ETH_RPC_RECORD=1 against %s to record it", path, nodeUrl)
+	}
+	requester, err := NewETHRPCRequesterWithOptions(&ClientOptions{
+		NodeUrls: []string{nodeUrl},
+		Fixture:  &FixtureOptions{Mode: mode, Path: path},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return requester
+}
 
 func TestETHRPCRequester_GetTransactionByHash(t *testing.T) {
-	txHash := "0xdba68e394b13ba81e6645d7f4bfeec950a8f7a881777d19ce19d6bff4524362d"
-	txInfo, err := NewETHRPCRequester(sepoliaUrl).GetTransactionByHash(txHash)
+	txInfo, err := newTestRequester(t, localUrl).GetTransactionByHash(fixtureTxHash1)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 	res, _ := json.Marshal(txInfo)
 	fmt.Println(string(res))
+	if !strings.EqualFold(txInfo.From, "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266") ||
+		!strings.EqualFold(txInfo.To, "0x6dB7Ee9774Be5a16685241fCeF5d6f968d9b0259") ||
+		txInfo.Value != "0x18c8b0c2ba6000" {
+		t.Fatalf("unexpected transaction %s", string(res))
+	}
 }
 
 func TestETHRPCRequester_GetTransactions(t *testing.T) {
-	txHash1 := "0xdba68e394b13ba81e6645d7f4bfeec950a8f7a881777d19ce19d6bff4524362d"
 	txHash2 := "0xdba68e394b13ba81e6645d7f4bfeec950a8f7a881777d19ce19d6bff45243aaa"
-	txHash3 := "0xfb308dbe4049fc290ad171c6bf51b7c1eacee7f5aedee13265011adfb71addc8"
-	txHashArr := []string{txHash1, txHash2, txHash3}
-	txInfos, err := NewETHRPCRequester(sepoliaUrl).GetTransactions(txHashArr)
+	txHashArr := []string{fixtureTxHash1, txHash2, fixtureTxHash2}
+	txInfos, err := newTestRequester(t, localUrl).GetTransactions(txHashArr)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
+	}
+	// txHash2 不存在，只影响自己那一项
+	for i, item := range txInfos {
+		if item.Err != nil {
+			fmt.Println(txHashArr[i], item.Err.Error())
+			continue
+		}
+		bytes, _ := json.Marshal(item.Value)
+		fmt.Println(string(bytes))
+	}
+	if len(txInfos) != 3 || txInfos[0].Err != nil || txInfos[1].Err == nil || txInfos[2].Err != nil {
+		t.Fatalf("unexpected results %+v", txInfos)
+	}
+	if txInfos[0].Value.Hash != fixtureTxHash1 || txInfos[2].Value.Hash != fixtureTxHash2 {
+		t.Fatal("results are not in input order")
+	}
+}
+
+func TestETHRPCRequester_GetTransactionReceipt(t *testing.T) {
+	receipt, err := newTestRequester(t, localUrl).GetTransactionReceipt(fixtureTxHash1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _ := json.Marshal(receipt)
+	fmt.Println(string(res))
+	if !receipt.Succeeded() || receipt.GasUsed != "0x5208" || receipt.TransactionHash != fixtureTxHash1 {
+		t.Fatalf("unexpected receipt %s", string(res))
+	}
+}
+
+func TestETHRPCRequester_GetTransactionReceipts(t *testing.T) {
+	missing := "0xdba68e394b13ba81e6645d7f4bfeec950a8f7a881777d19ce19d6bff45243aaa"
+	txHashArr := []string{fixtureTxHash1, missing, fixtureTxHash2}
+	receipts, err := newTestRequester(t, localUrl).GetTransactionReceipts(txHashArr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receipts) != 3 || receipts[0].Err != nil || receipts[1].Err == nil || receipts[2].Err != nil {
+		t.Fatalf("unexpected results %+v", receipts)
+	}
+	if receipts[2].Value.TransactionHash != fixtureTxHash2 || receipts[2].Value.CumulativeGasUsed != "0xa410" {
+		t.Fatalf("unexpected receipt %+v", receipts[2].Value)
 	}
-	bytes, _ := json.Marshal(txInfos)
-	fmt.Println(string(bytes))
 }
 
+func TestETHRPCRequester_GetBlockReceipts(t *testing.T) {
+	requester := newTestRequester(t, localUrl)
+	receipt, err := requester.GetTransactionReceipt(fixtureTxHash1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipts, err := requester.GetBlockReceiptsByHash(receipt.BlockHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(receipts) != 2 || receipts[0].TransactionHash != fixtureTxHash1 || receipts[1].TransactionHash != fixtureTxHash2 {
+		t.Fatalf("unexpected block receipts %+v", receipts)
+	}
+
+	// 节点不支持 eth_getBlockReceipts 时回退为逐笔查询
+	requester.markUnsupported("eth_getBlockReceipts", &methodNotFoundError{})
+	number, _ := new(big.Int).SetString(receipt.BlockNumber[2:], 16)
+	fallback, err := requester.GetBlockReceiptsByNumber(number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fallback) != 2 || fallback[1].CumulativeGasUsed != receipts[1].CumulativeGasUsed {
+		t.Fatalf("unexpected fallback receipts %+v", fallback)
+	}
+}
+
+type methodNotFoundError struct{}
+
+func (e *methodNotFoundError) Error() string  { return "the method does not exist/is not available" }
+func (e *methodNotFoundError) ErrorCode() int { return -32601 }
+
 func TestETHRPCRequester_GetETHBalance(t *testing.T) {
 	address := "0xeE9A7E064DdddB8db82bB5cEf9E884409E7273fE"
-	res, err := NewETHRPCRequester(sepoliaUrl).GetETHBalance(address)
+	res, err := newTestRequester(t, localUrl).GetETHBalance(address)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 	fmt.Println(res)
+	if res != "1000000000000000000" {
+		t.Fatalf("unexpected balance %s", res)
+	}
+}
+
+func TestETHRPCRequester_GetETHBalanceAt(t *testing.T) {
+	requester := newTestRequester(t, localUrl)
+	address := "0xeE9A7E064DdddB8db82bB5cEf9E884409E7273fE"
+	ctx := context.Background()
+	balance, ref, err := requester.GetETHBalanceAt(ctx, address, AtLatest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(balance, ref.Number, ref.Hash)
+	if ref.Number == nil || ref.Hash == "" {
+		t.Fatalf("unexpected block ref %+v", ref)
+	}
+	// 按 hash 读取同一个区块，结果一致
+	pinned, pinnedRef, err := requester.GetETHBalanceAt(ctx, address, AtBlockHash(ref.Hash, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pinned != balance || pinnedRef.Number.Cmp(ref.Number) != 0 || pinnedRef.Hash != ref.Hash {
+		t.Fatalf("unexpected pinned balance %s %+v", pinned, pinnedRef)
+	}
+	nonce, pendingRef, err := requester.GetNonceAt(ctx, "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266", AtPending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nonce != 2 || pendingRef.Hash != "" {
+		t.Fatalf("unexpected pending nonce %d %+v", nonce, pendingRef)
+	}
+	unknown := "0xdba68e394b13ba81e6645d7f4bfeec950a8f7a881777d19ce19d6bff45243aaa"
+	if _, _, err := requester.GetETHBalanceAt(ctx, address, AtBlockHash(unknown, true)); err == nil {
+		t.Fatal("expected error for unknown block")
+	}
 }
 
 func TestETHRPCRequester_GetLastestBlockNumber(t *testing.T) {
-	number, err := NewETHRPCRequester(sepoliaUrl).GetLastestBlockNumber()
+	number, err := newTestRequester(t, localUrl).GetLastestBlockNumber()
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 	fmt.Println(number.String())
+	if number.Sign() <= 0 {
+		t.Fatalf("unexpected block number %s", number)
+	}
+}
+
+func TestETHRPCRequester_GetLastestBlockNumberContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	number, err := newTestRequester(t, localUrl).GetLastestBlockNumberContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(number.String())
+	if number.Sign() <= 0 {
+		t.Fatalf("unexpected block number %s", number)
+	}
 }
 
 func TestETHRPCRequester_GetBlockInfoByNumber(t *testing.T) {
-	number, _ := NewETHRPCRequester(sepoliaUrl).GetLastestBlockNumber()
+	requester := newTestRequester(t, localUrl)
+	number, err := requester.GetLastestBlockNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
 	fmt.Println(number.String())
-	fullBlock, err := NewETHRPCRequester(sepoliaUrl).GetBlockInfoByNumber(number)
+	fullBlock, err := requester.GetBlockInfoByNumber(number)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 	info, _ := json.Marshal(fullBlock)
 	fmt.Println(string(info))
+	if fullBlock.Number != fmt.Sprintf("%#x", number) {
+		t.Fatalf("unexpected block number %s", fullBlock.Number)
+	}
 }
 
 func TestETHRPCRequester_GetBlockInfoByHash(t *testing.T) {
-	hash := "0xf9ac4c0f3f5f1ffbe471b93feeafe69a5865d93fbffa8cfe72c2393479ccb259"
-	fullBlock, err := NewETHRPCRequester(sepoliaUrl).GetBlockInfoByHash(hash)
+	requester := newTestRequester(t, localUrl)
+	txInfo, err := requester.GetTransactionByHash(fixtureTxHash1)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
+	}
+	fullBlock, err := requester.GetBlockInfoByHash(txInfo.BlockHash)
+	if err != nil {
+		t.Fatal(err)
 	}
 	info, _ := json.Marshal(fullBlock)
 	fmt.Println(string(info))
+	if fullBlock.Hash != txInfo.BlockHash || fullBlock.Number != txInfo.BlockNumber {
+		t.Fatalf("unexpected block %s", string(info))
+	}
+	found := false
+	for _, tx := range fullBlock.Transactions {
+		found = found || tx.Hash == fixtureTxHash1
+	}
+	if !found {
+		t.Fatal("transaction not found in block")
+	}
+}
+
+func TestETHRPCRequester_GetChainIdentity(t *testing.T) {
+	requester := newTestRequester(t, localUrl)
+	identity, err := requester.GetChainIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(identity.ChainId, identity.GenesisHash)
+	// 本地 geth --dev 节点
+	if identity.ChainId.Int64() != 1337 || len(identity.GenesisHash) != 66 {
+		t.Fatalf("unexpected chain identity %s %s", identity.ChainId, identity.GenesisHash)
+	}
+	// chainId 只查询一次
+	chainId, err := requester.GetChainId()
+	if err != nil || chainId.Cmp(identity.ChainId) != 0 {
+		t.Fatalf("unexpected chain id %s %v", chainId, err)
+	}
+}
+
+func TestETHRPCRequester_Capabilities(t *testing.T) {
+	requester := newTestRequester(t, localUrl)
+	caps, err := requester.ProbeCapabilities(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(caps.ClientVersion, caps.SupportedMethods(), caps.ArchiveState)
+	// 本地 geth 开启了 debug 接口，没有 parity 的 trace 接口；链上区块数太少，无法判断是否为归档节点
+	if !strings.HasPrefix(caps.ClientVersion, "Geth/") || !caps.Methods["debug_traceBlockByNumber"] || caps.Methods["trace_block"] ||
+		caps.ArchiveState != ArchiveUnknown {
+		t.Fatalf("unexpected capabilities %+v", caps)
+	}
+	method, ok := requester.pickMethod(context.Background(), "trace_block", "debug_traceBlockByNumber")
+	if !ok || method != "debug_traceBlockByNumber" {
+		t.Fatalf("unexpected method %s", method)
+	}
+}
+
+// priorityFeeService 只实现 eth_maxPriorityFeePerGas，记录收到的请求数
+type priorityFeeService struct {
+	calls atomic.Int64
+}
+
+func (s *priorityFeeService) MaxPriorityFeePerGas() hexutil.Uint64 {
+	s.calls.Add(1)
+	return 1
+}
+
+func TestETHRPCRequester_SupportsProbesSingleMethod(t *testing.T) {
+	service := &priorityFeeService{}
+	requester := newFakeRequester(t, "eth", service, nil)
+	if !requester.supports(context.Background(), "eth_maxPriorityFeePerGas") || requester.supports(context.Background(), "eth_feeHistory") {
+		t.Fatal("unexpected probe result")
+	}
+	// 结果被记录，不会再次探测，也不会触发完整探测
+	if !requester.supports(context.Background(), "eth_maxPriorityFeePerGas") || service.calls.Load() != 1 {
+		t.Fatalf("expected one probe, got %d", service.calls.Load())
+	}
+	if requester.capabilities.caps != nil {
+		t.Fatal("supports should not run the full probe")
+	}
+}
+
+type codedError struct {
+	code int
+	msg  string
+}
+
+func (e *codedError) Error() string  { return e.msg }
+func (e *codedError) ErrorCode() int { return e.code }
+
+func TestIsMethodUnsupported(t *testing.T) {
+	cases := []struct {
+		err         error
+		unsupported bool
+	}{
+		{&methodNotFoundError{}, true},
+		{&codedError{-32004, "method not supported"}, true},
+		{&codedError{-32000, "the method trace_block does not exist/is not available"}, true},
+		{&codedError{-32000, "Method not found"}, true},
+		// 数据不存在说明方法本身可用
+		{&codedError{-32000, "header not available"}, false},
+		{&codedError{-32000, "missing trie node 0xabc (path ) state 0xabc is not available"}, false},
+		{&codedError{-32000, "transaction type not supported"}, false},
+		{errors.New("method not found"), false},
+	}
+	for i, c := range cases {
+		if isMethodUnsupported(c.err) != c.unsupported {
+			t.Fatalf("case %d: %v expected unsupported=%v", i, c.err, c.unsupported)
+		}
+	}
 }
 
 func TestETHRPCRequester_ETHCall(t *testing.T) {
@@ -407,15 +681,44 @@ func TestETHRPCRequester_ETHCall(t *testing.T) {
 		Gas:  hexutil.EncodeUint64(30000),
 	}
 	result := ""
-	err = NewETHRPCRequester(localUrl).ETHCall(&result, args)
+	err = newTestRequester(t, localUrl).ETHCall(&result, args)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 	fmt.Println(result)
 	ten, _ := new(big.Int).SetString(result[2:], 16)
 	fmt.Println(ten)
 }
 
+func TestETHRPCRequester_SimulateTransaction(t *testing.T) {
+	requester := newTestRequester(t, localUrl)
+	from := "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"
+	to := common.HexToAddress("0x6dB7Ee9774Be5a16685241fCeF5d6f968d9b0259")
+	transfer := types.NewTx(&types.LegacyTx{GasPrice: big.NewInt(2000000000), To: &to, Value: big.NewInt(1)})
+	gas, err := requester.SimulateTransaction(from, transfer, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 21000 加上 20% 的余量
+	if gas != 25200 {
+		t.Fatalf("unexpected gas %d", gas)
+	}
+
+	// 部署时直接 revert Error("nope") 的合约
+	initCode := "0x6064600c60003960646000fd" +
+		"08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000004" +
+		"6e6f706500000000000000000000000000000000000000000000000000000000"
+	deploy := types.NewTx(&types.LegacyTx{GasPrice: big.NewInt(2000000000), Gas: 100000, Data: common.FromHex(initCode)})
+	_, err = requester.SimulateTransaction(from, deploy, "")
+	var revertErr *ExecutionRevertedError
+	if !errors.As(err, &revertErr) || revertErr.Kind != RevertReason || revertErr.Reason != "nope" {
+		t.Fatalf("expected revert with reason, got %v", err)
+	}
+	fmt.Println(err)
+}
+
 func TestETHRPCRequester_CreateETHWallet(t *testing.T) {
 	address, err := NewETHWalletRequester().CreateETHWallet("12345678")
 	if err != nil {
@@ -426,23 +729,36 @@ func TestETHRPCRequester_CreateETHWallet(t *testing.T) {
 
 func TestETHRPCRequester_GetNonce(t *testing.T) {
 	address := "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"
-	nonce, err := NewETHRPCRequester(localUrl).GetNonce(address)
+	nonce, err := newTestRequester(t, localUrl).GetNonce(address)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 	fmt.Println(nonce)
+	// 录制时该地址已经发出了两笔交易
+	if nonce != 2 {
+		t.Fatalf("unexpected nonce %d", nonce)
+	}
 }
 
 func TestETHRPCRequester_GetEthBalances(t *testing.T) {
 	address1 := "0x6dB7Ee9774Be5a16685241fCeF5d6f968d9b0259"
 	address2 := "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"
 	addressArr := []string{address1, address2}
-	res, err := NewETHRPCRequester(localUrl).GetEthBalances(addressArr)
+	res, err := newTestRequester(t, localUrl).GetEthBalances(addressArr)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
+	}
+	for i, item := range res {
+		fmt.Println(addressArr[i], item.Value, item.Err)
+	}
+	if len(res) != 2 || res[0].Err != nil || res[1].Err != nil {
+		t.Fatalf("unexpected balances %+v", res)
+	}
+	// 录制前 address1 至少收到过 fixtureTxHash1 的转账
+	balance, ok := new(big.Int).SetString(res[0].Value, 10)
+	if !ok || balance.Cmp(big.NewInt(6976000000000000)) < 0 {
+		t.Fatalf("unexpected balance %s", res[0].Value)
 	}
-	fmt.Println(res)
-	// [6976000000000000 9999977099090695592882]
 }
 
 func TestETHRPCRequester_SendETHTransaction(t *testing.T) {
@@ -451,13 +767,14 @@ func TestETHRPCRequester_SendETHTransaction(t *testing.T) {
 	value := "1000"
 	gasLimit := uint64(21000)
 	gasPrice := uint64(36000000000)
+	requester := newTestRequester(t, localUrl)
 	err := tool.UnlockETHWallet("./keystores", from, "12345678")
 	if err != nil {
-		panic(err)
+		t.Skip("unlock wallet failed", err)
 	}
-	txHash, err := NewETHRPCRequester(localUrl).SendETHTransaction(from, to, value, gasLimit, gasPrice)
+	txHash, err := requester.SendETHTransaction(from, to, value, gasLimit, gasPrice)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 	fmt.Println(txHash)
 }
@@ -478,11 +795,13 @@ func TestETHRPCRequester_GetERC20Balance(t *testing.T) {
 	item2.ContractDecimal = 2
 	params = append(params, item2)
 
-	res, err := NewETHRPCRequester(localUrl).GetERC20Balances(params)
+	res, err := newTestRequester(t, localUrl).GetERC20Balances(params)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
+	}
+	for i, item := range res {
+		fmt.Println(params[i].UserAddress, item.Value, item.Err)
 	}
-	fmt.Println(res)
 }
 
 func TestETHRPCRequester_SendERC20Transaction(t *testing.T) {
@@ -493,13 +812,240 @@ func TestETHRPCRequester_SendERC20Transaction(t *testing.T) {
 	receiver := "0xeE9A7E064DdddB8db82bB5cEf9E884409E7273fE"
 	gasLimit := uint64(500000)
 	gasPrice := uint64(36000000000)
+	requester := newTestRequester(t, localUrl)
 	err := tool.UnlockETHWallet("./keystores", from, "12345678")
 	if err != nil {
-		panic(err)
+		t.Skip("unlock wallet failed", err)
 	}
-	txHash, err := NewETHRPCRequester(localUrl).SendERC20Transaction(from, contract, receiver, amount, gasLimit, gasPrice, decimal)
+	txHash, err := requester.SendERC20Transaction(from, contract, receiver, amount, gasLimit, gasPrice, decimal)
 	if err != nil {
-		panic(err)
+		t.Fatal(err)
 	}
 	fmt.Println(txHash)
 }
+
+// newHeadsService 支持 eth_subscribe newHeads，heads 中的区块头推送给当前的订阅
+type newHeadsService struct {
+	heads chan *model.Header
+	subs  atomic.Int64 // 收到的订阅请求数
+}
+
+func newNewHeadsService() *newHeadsService {
+	return &newHeadsService{heads: make(chan *model.Header, 16)}
+}
+
+func (s *newHeadsService) NewHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, ok := rpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, rpc.ErrNotificationsUnsupported
+	}
+	s.subs.Add(1)
+	sub := notifier.CreateSubscription()
+	go func() {
+		for {
+			select {
+			case head := <-s.heads:
+				_ = notifier.Notify(sub.ID, head)
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+func TestETHRPCRequester_SubscribeNewHeads(t *testing.T) {
+	service := newNewHeadsService()
+	url, _ := newFakeWsNode(t, "eth", service)
+	requester, err := NewETHRPCRequester(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !requester.client.SupportsSubscriptions() {
+		t.Fatal("ws connection should support subscriptions")
+	}
+	heads := make(chan *model.Header)
+	sub, err := requester.SubscribeNewHeads(heads)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+	for i := 1; i <= 3; i++ {
+		service.heads <- &model.Header{Number: hexutil.EncodeUint64(uint64(i))}
+		select {
+		case head := <-heads:
+			if head.Number != hexutil.EncodeUint64(uint64(i)) {
+				t.Fatalf("unexpected head %s", head.Number)
+			}
+		case err := <-sub.Err():
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for head")
+		}
+	}
+}
+
+// headService 只实现 eth_blockNumber，用于测试节点探测
+type headService struct {
+	head  atomic.Uint64
+	calls atomic.Int64
+}
+
+func (s *headService) BlockNumber() hexutil.Uint64 {
+	s.calls.Add(1)
+	return hexutil.Uint64(s.head.Load())
+}
+
+func TestETHRPCClient_Probe(t *testing.T) {
+	good, lagging := &headService{}, &headService{}
+	good.head.Store(100)
+	lagging.head.Store(90)
+	goodNode, laggingNode := newFakeNode(t, "eth", good), newFakeNode(t, "eth", lagging)
+	client, err := NewETHRPCClientWithOptions(&ClientOptions{
+		NodeUrls:      []string{laggingNode.URL, goodNode.URL},
+		ProbeInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Probe()
+	ranked := client.ranked()
+	if ranked[0].url != goodNode.URL || ranked[0].head != 100 || !ranked[1].stale {
+		t.Fatalf("unexpected ranking %s %d %v", ranked[0].url, ranked[0].head, ranked[1].stale)
+	}
+
+	// 后台定时探测，不需要手动调用 Probe
+	lagging.head.Store(100)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		client.lock.Lock()
+		stale := client.endpoints[0].stale
+		client.lock.Unlock()
+		if !stale {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("background probe did not refresh the lagging node")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Close 之后停止探测
+	client.Close()
+	time.Sleep(50 * time.Millisecond)
+	calls := good.calls.Load()
+	time.Sleep(100 * time.Millisecond)
+	if good.calls.Load() != calls {
+		t.Fatal("probe loop still running after Close")
+	}
+}
+
+func TestIsTransportError(t *testing.T) {
+	// 没有监听的端口，连接被拒绝
+	client, err := rpc.Dial("http://127.0.0.1:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	number := ""
+	refused := client.CallContext(context.Background(), &number, "eth_blockNumber")
+
+	cases := []struct {
+		err       error
+		transport bool
+	}{
+		{refused, true},
+		{io.ErrUnexpectedEOF, true},
+		{&url.Error{Op: "Post", URL: localUrl, Err: io.EOF}, true},
+		{&url.Error{Op: "Post", URL: localUrl, Err: errors.New("fixture not found")}, false},
+		{&json.SyntaxError{}, false},
+		{rpc.HTTPError{StatusCode: 500}, false},
+		{&ExecutionRevertedError{}, false},
+	}
+	for i, c := range cases {
+		if isTransportError(c.err) != c.transport {
+			t.Fatalf("case %d: %v expected transport=%v", i, c.err, c.transport)
+		}
+	}
+}
+
+func TestETHRPCRequester_GetVerifiedAccount(t *testing.T) {
+	requester := newTestRequester(t, localUrl)
+	address := "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"
+	account, err := requester.GetVerifiedAccount(address, []string{"0x0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println(account.Balance, account.Nonce, account.StateRoot.Hex(), account.Block.Number)
+	if account.Nonce != 2 || account.Balance.Sign() <= 0 || account.CodeHash != types.EmptyCodeHash {
+		t.Fatalf("unexpected account %+v", account)
+	}
+	if account.Storage[common.Hash{}].Sign() != 0 {
+		t.Fatalf("unexpected storage %+v", account.Storage)
+	}
+
+	// 不存在的账户也有证明
+	empty, err := requester.GetVerifiedAccount("0x000000000000000000000000000000000000dEaD", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.Balance.Sign() != 0 || empty.StorageHash != types.EmptyRootHash {
+		t.Fatalf("unexpected empty account %+v", empty)
+	}
+
+	// 篡改节点返回的余额，本地验证失败
+	proof, err := requester.GetProof(address, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAccountProof(proof, account.StateRoot, address, nil); err != nil {
+		t.Fatal(err)
+	}
+	// 返回的账户或存储槽与请求不一致
+	if _, err := VerifyAccountProof(proof, account.StateRoot, "0x000000000000000000000000000000000000dEaD", nil); !errors.Is(err, ErrProofInvalid) {
+		t.Fatalf("expected ErrProofInvalid for other account, got %v", err)
+	}
+	if _, err := VerifyAccountProof(proof, account.StateRoot, address, []string{"0x0"}); !errors.Is(err, ErrProofInvalid) {
+		t.Fatalf("expected ErrProofInvalid for missing storage, got %v", err)
+	}
+	extra := *proof
+	extra.StorageProof = []model.StorageProof{{Key: "0x0", Value: "0x0"}}
+	if _, err := VerifyAccountProof(&extra, account.StateRoot, address, nil); !errors.Is(err, ErrProofInvalid) {
+		t.Fatalf("expected ErrProofInvalid for extra storage, got %v", err)
+	}
+	proof.Balance = "0x1"
+	if _, err := VerifyAccountProof(proof, account.StateRoot, address, nil); !errors.Is(err, ErrProofInvalid) {
+		t.Fatalf("expected ErrProofInvalid, got %v", err)
+	}
+}
+
+func TestVerifyHeader(t *testing.T) {
+	header := &types.Header{
+		ParentHash: common.HexToHash("0x01"),
+		Root:       common.HexToHash("0x02"),
+		Number:     big.NewInt(10),
+		GasLimit:   30000000,
+		Difficulty: new(big.Int),
+		BaseFee:    big.NewInt(7),
+	}
+	raw, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := BlockRef{Number: header.Number, Hash: header.Hash().Hex()}
+	verified, err := verifyHeader(raw, ref, AtLatest)
+	if err != nil || verified.Root != header.Root {
+		t.Fatalf("unexpected header %+v %v", verified, err)
+	}
+
+	// 节点伪造 stateRoot，但返回原来的区块 hash
+	forged := *header
+	forged.Root = common.HexToHash("0x03")
+	forgedRaw, _ := json.Marshal(&forged)
+	if _, err := verifyHeader(forgedRaw, ref, AtLatest); !errors.Is(err, ErrProofInvalid) {
+		t.Fatalf("expected ErrProofInvalid, got %v", err)
+	}
+	// 返回的区块与可信的区块 hash 不一致
+	if _, err := verifyHeader(raw, ref, AtBlockHash(forged.Hash().Hex(), false)); !errors.Is(err, ErrProofInvalid) {
+		t.Fatalf("expected ErrProofInvalid, got %v", err)
+	}
+}
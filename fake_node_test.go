@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// newFakeNode 在本地启动 rpc 服务，service 的方法注册在 namespace 下，比如 eth 下的 GetBalance 对应 eth_getBalance
+func newFakeNode(t *testing.T, namespace string, service interface{}) *httptest.Server {
+	server := rpc.NewServer()
+	if err := server.RegisterName(namespace, service); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+// newFakeWsNode 与 newFakeNode 相同，但使用 ws 连接，支持订阅。返回 ws:// 地址，以及断开所有已建立连接的函数
+func newFakeWsNode(t *testing.T, namespace string, service interface{}) (string, func()) {
+	server := rpc.NewServer()
+	if err := server.RegisterName(namespace, service); err != nil {
+		t.Fatal(err)
+	}
+	var lock sync.Mutex
+	var conns []net.Conn
+	httpServer := httptest.NewUnstartedServer(server.WebsocketHandler([]string{"*"}))
+	// ws 连接被 hijack 后 httptest 不再管理，需要自己记录
+	httpServer.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			lock.Lock()
+			conns = append(conns, conn)
+			lock.Unlock()
+		}
+	}
+	httpServer.Start()
+	t.Cleanup(httpServer.Close)
+	drop := func() {
+		lock.Lock()
+		defer lock.Unlock()
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+		conns = nil
+	}
+	return "ws" + strings.TrimPrefix(httpServer.URL, "http"), drop
+}
+
+// newFakeRequester 连接 newFakeNode 的 requester，options 为 nil 时使用默认参数，其中的 NodeUrls 会被覆盖
+func newFakeRequester(t *testing.T, namespace string, service interface{}, options *ClientOptions) *ETHRPCRequester {
+	if options == nil {
+		options = &ClientOptions{}
+	}
+	options.NodeUrls = []string{newFakeNode(t, namespace, service).URL}
+	requester, err := NewETHRPCRequesterWithOptions(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return requester
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"eth-relay/model"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// errNoBaseFee 伦敦升级之前的链没有 base fee，只能使用 gasPrice
+var errNoBaseFee = errors.New("chain does not support EIP-1559")
+
+type FeeTier string
+
+const (
+	FeeSlow     FeeTier = "slow"
+	FeeStandard FeeTier = "standard"
+	FeeFast     FeeTier = "fast"
+)
+
+var feeTiers = []FeeTier{FeeSlow, FeeStandard, FeeFast}
+
+type FeeOracleOptions struct {
+	BlockCount    int        // 统计最近多少个区块，默认 20
+	Percentiles   [3]float64 // slow、standard、fast 使用的小费百分位，默认 10、50、90
+	MaxFeeCeiling *big.Int   // maxFeePerGas 以及 legacy gasPrice 的上限，为 nil 时不限制
+}
+
+// FeeSuggestion 某一档位的手续费建议；Legacy 为 true 时只有 GasPrice
+type FeeSuggestion struct {
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	GasPrice             *big.Int
+	Legacy               bool
+	Capped               bool // 被 MaxFeeCeiling 截断
+}
+
+type FeeEstimate struct {
+	BaseFee      *big.Int // 下一个区块的 base fee，legacy 链为 nil
+	BaseFeeTrend string   // rising、falling、stable
+	Legacy       bool
+	Tiers        map[FeeTier]*FeeSuggestion
+}
+
+// baseFeeHeadroom 每个档位预留几个区块的 base fee 上涨空间，每个区块最多上涨 12.5%
+var baseFeeHeadroom = map[FeeTier]int{FeeSlow: 1, FeeStandard: 3, FeeFast: 6}
+
+func defaultFeeOracleOptions(options *FeeOracleOptions) FeeOracleOptions {
+	res := FeeOracleOptions{BlockCount: 20, Percentiles: [3]float64{10, 50, 90}}
+	if options == nil {
+		return res
+	}
+	if options.BlockCount > 0 {
+		res.BlockCount = options.BlockCount
+	}
+	if options.Percentiles != [3]float64{} {
+		res.Percentiles = options.Percentiles
+	}
+	res.MaxFeeCeiling = options.MaxFeeCeiling
+	return res
+}
+
+// SuggestFees 根据 eth_feeHistory 和 eth_maxPriorityFeePerGas 给出 slow、standard、fast 三档 EIP-1559 手续费，
+// 节点不支持或者链还没有 base fee 时退回 eth_gasPrice
+func (r *ETHRPCRequester) SuggestFees() (*FeeEstimate, error) {
+	return r.SuggestFeesContext(context.Background())
+}
+
+func (r *ETHRPCRequester) SuggestFeesContext(ctx context.Context) (*FeeEstimate, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	if r.supports(ctx, "eth_feeHistory") {
+		estimate, err := r.suggestDynamicFees(ctx)
+		if err == nil {
+			return estimate, nil
+		}
+		if !errors.Is(err, errNoBaseFee) && !isMethodUnsupported(err) {
+			return nil, err
+		}
+		r.markUnsupported("eth_feeHistory", err)
+	}
+	return r.suggestLegacyFees(ctx)
+}
+
+func (r *ETHRPCRequester) suggestDynamicFees(ctx context.Context) (*FeeEstimate, error) {
+	options := r.feeOptions
+	history := model.FeeHistory{}
+	err := r.client.CallContext(ctx, &history, "eth_feeHistory",
+		hexutil.EncodeUint64(uint64(options.BlockCount)), "latest", options.Percentiles[:])
+	if err != nil {
+		return nil, err
+	}
+	if len(history.BaseFeePerGas) == 0 {
+		return nil, errNoBaseFee
+	}
+	baseFees := make([]*big.Int, len(history.BaseFeePerGas))
+	for i, fee := range history.BaseFeePerGas {
+		if baseFees[i], err = hexutil.DecodeBig(fee); err != nil {
+			return nil, fmt.Errorf("invalid base fee %s", fee)
+		}
+	}
+	baseFee := baseFees[len(baseFees)-1]
+	if baseFee.Sign() == 0 {
+		return nil, errNoBaseFee
+	}
+
+	// 空块没有小费数据，不参与统计
+	tips := make([]*big.Int, len(feeTiers))
+	for k := range feeTiers {
+		var samples []*big.Int
+		for i, rewards := range history.Reward {
+			if (i < len(history.GasUsedRatio) && history.GasUsedRatio[i] == 0) || k >= len(rewards) {
+				continue
+			}
+			if tip, err := hexutil.DecodeBig(rewards[k]); err == nil {
+				samples = append(samples, tip)
+			}
+		}
+		tips[k] = median(samples)
+	}
+	// 节点自己的建议作为 standard 的下限，三档保持递增
+	if r.supports(ctx, "eth_maxPriorityFeePerGas") {
+		suggested := ""
+		if err := r.client.CallContext(ctx, &suggested, "eth_maxPriorityFeePerGas"); err == nil {
+			if tip, err := hexutil.DecodeBig(suggested); err == nil && tip.Cmp(tips[1]) > 0 {
+				tips[1] = tip
+			}
+		} else {
+			r.markUnsupported("eth_maxPriorityFeePerGas", err)
+		}
+	}
+	if tips[0].Cmp(tips[1]) > 0 {
+		tips[0] = new(big.Int).Set(tips[1])
+	}
+	if tips[2].Cmp(tips[1]) < 0 {
+		tips[2] = new(big.Int).Set(tips[1])
+	}
+
+	trend := baseFeeTrend(baseFees)
+	estimate := &FeeEstimate{BaseFee: baseFee, BaseFeeTrend: trend, Tiers: make(map[FeeTier]*FeeSuggestion)}
+	for k, tier := range feeTiers {
+		blocks := baseFeeHeadroom[tier]
+		if trend == "rising" {
+			blocks += 2
+		}
+		maxFee := new(big.Int).Set(baseFee)
+		for i := 0; i < blocks; i++ {
+			maxFee.Mul(maxFee, big.NewInt(9))
+			maxFee.Div(maxFee, big.NewInt(8))
+		}
+		maxFee.Add(maxFee, tips[k])
+		suggestion := &FeeSuggestion{MaxFeePerGas: maxFee, MaxPriorityFeePerGas: new(big.Int).Set(tips[k])}
+		if ceiling := options.MaxFeeCeiling; ceiling != nil && maxFee.Cmp(ceiling) > 0 {
+			suggestion.MaxFeePerGas = new(big.Int).Set(ceiling)
+			suggestion.Capped = true
+			if suggestion.MaxPriorityFeePerGas.Cmp(ceiling) > 0 {
+				suggestion.MaxPriorityFeePerGas = new(big.Int).Set(ceiling)
+			}
+		}
+		estimate.Tiers[tier] = suggestion
+	}
+	return estimate, nil
+}
+
+func (r *ETHRPCRequester) suggestLegacyFees(ctx context.Context) (*FeeEstimate, error) {
+	result := ""
+	if err := r.client.CallContext(ctx, &result, "eth_gasPrice"); err != nil {
+		return nil, err
+	}
+	gasPrice, err := hexutil.DecodeBig(result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gas price %s", result)
+	}
+	estimate := &FeeEstimate{Legacy: true, BaseFeeTrend: "stable", Tiers: make(map[FeeTier]*FeeSuggestion)}
+	// slow 打九折，fast 加价 25%
+	multipliers := map[FeeTier][2]int64{FeeSlow: {9, 10}, FeeStandard: {1, 1}, FeeFast: {5, 4}}
+	for _, tier := range feeTiers {
+		m := multipliers[tier]
+		price := new(big.Int).Mul(gasPrice, big.NewInt(m[0]))
+		price.Div(price, big.NewInt(m[1]))
+		suggestion := &FeeSuggestion{GasPrice: price, Legacy: true}
+		if ceiling := r.feeOptions.MaxFeeCeiling; ceiling != nil && price.Cmp(ceiling) > 0 {
+			suggestion.GasPrice = new(big.Int).Set(ceiling)
+			suggestion.Capped = true
+		}
+		estimate.Tiers[tier] = suggestion
+	}
+	return estimate, nil
+}
+
+// baseFeeTrend 比较下一个区块和统计区间第一个区块的 base fee，变化不超过 5% 视为平稳
+func baseFeeTrend(baseFees []*big.Int) string {
+	first, last := baseFees[0], baseFees[len(baseFees)-1]
+	if first.Sign() == 0 {
+		return "stable"
+	}
+	diff := new(big.Int).Sub(last, first)
+	diff.Mul(diff, big.NewInt(100))
+	diff.Div(diff, first)
+	switch {
+	case diff.Cmp(big.NewInt(5)) > 0:
+		return "rising"
+	case diff.Cmp(big.NewInt(-5)) < 0:
+		return "falling"
+	}
+	return "stable"
+}
+
+func median(values []*big.Int) *big.Int {
+	if len(values) == 0 {
+		return big.NewInt(0)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].Cmp(values[j]) < 0 })
+	return new(big.Int).Set(values[len(values)/2])
+}
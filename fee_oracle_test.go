@@ -0,0 +1,97 @@
+package main
+
+import (
+	"eth-relay/model"
+	"math/big"
+	"testing"
+)
+
+const gwei = 1000000000
+
+// feeService 伦敦升级之后 base fee 为 baseFee，没有 base fee 时模拟升级之前的链
+type feeService struct {
+	baseFee int64
+}
+
+func (s *feeService) FeeHistory(blockCount string, newest string, percentiles []float64) model.FeeHistory {
+	history := model.FeeHistory{OldestBlock: "0x1"}
+	for i := 0; i < 4; i++ {
+		history.BaseFeePerGas = append(history.BaseFeePerGas, toHex(s.baseFee))
+		history.GasUsedRatio = append(history.GasUsedRatio, 0.5)
+		history.Reward = append(history.Reward, []string{toHex(1 * gwei), toHex(2 * gwei), toHex(int64(5+i) * gwei)})
+	}
+	history.BaseFeePerGas = append(history.BaseFeePerGas, toHex(s.baseFee))
+	// 空块的小费不参与统计
+	history.GasUsedRatio[0] = 0
+	history.Reward[0] = []string{toHex(100 * gwei), toHex(100 * gwei), toHex(100 * gwei)}
+	return history
+}
+
+func (s *feeService) MaxPriorityFeePerGas() string {
+	return toHex(3 * gwei)
+}
+
+func (s *feeService) GasPrice() string {
+	return toHex(20 * gwei)
+}
+
+func toHex(n int64) string {
+	return "0x" + big.NewInt(n).Text(16)
+}
+
+func newFeeRequester(t *testing.T, service *feeService, options *FeeOracleOptions) *ETHRPCRequester {
+	return newFakeRequester(t, "eth", service, &ClientOptions{FeeOracle: options})
+}
+
+func TestETHRPCRequester_SuggestFees(t *testing.T) {
+	requester := newFeeRequester(t, &feeService{baseFee: 10 * gwei}, nil)
+	estimate, err := requester.SuggestFees()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if estimate.Legacy || estimate.BaseFee.Int64() != 10*gwei || estimate.BaseFeeTrend != "stable" {
+		t.Fatalf("unexpected estimate %+v", estimate)
+	}
+	slow, standard, fast := estimate.Tiers[FeeSlow], estimate.Tiers[FeeStandard], estimate.Tiers[FeeFast]
+	// standard 取节点建议的 3 gwei，fast 取 90 分位的中位数 7 gwei
+	if slow.MaxPriorityFeePerGas.Int64() != 1*gwei || standard.MaxPriorityFeePerGas.Int64() != 3*gwei ||
+		fast.MaxPriorityFeePerGas.Int64() != 7*gwei {
+		t.Fatalf("unexpected tips %s %s %s", slow.MaxPriorityFeePerGas, standard.MaxPriorityFeePerGas, fast.MaxPriorityFeePerGas)
+	}
+	if slow.MaxFeePerGas.Cmp(standard.MaxFeePerGas) >= 0 || standard.MaxFeePerGas.Cmp(fast.MaxFeePerGas) >= 0 {
+		t.Fatalf("max fee is not increasing %s %s %s", slow.MaxFeePerGas, standard.MaxFeePerGas, fast.MaxFeePerGas)
+	}
+	if slow.MaxFeePerGas.Int64() != 10*gwei*9/8+1*gwei {
+		t.Fatalf("unexpected slow max fee %s", slow.MaxFeePerGas)
+	}
+}
+
+func TestETHRPCRequester_SuggestFeesCeiling(t *testing.T) {
+	ceiling := big.NewInt(15 * gwei)
+	requester := newFeeRequester(t, &feeService{baseFee: 10 * gwei}, &FeeOracleOptions{MaxFeeCeiling: ceiling})
+	estimate, err := requester.SuggestFees()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast := estimate.Tiers[FeeFast]
+	if !fast.Capped || fast.MaxFeePerGas.Cmp(ceiling) != 0 {
+		t.Fatalf("expected fast tier to be capped, got %+v", fast)
+	}
+	if estimate.Tiers[FeeSlow].Capped {
+		t.Fatal("slow tier should not be capped")
+	}
+}
+
+func TestETHRPCRequester_SuggestFeesLegacy(t *testing.T) {
+	requester := newFeeRequester(t, &feeService{}, nil)
+	estimate, err := requester.SuggestFees()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !estimate.Legacy || estimate.BaseFee != nil {
+		t.Fatalf("expected legacy estimate, got %+v", estimate)
+	}
+	if estimate.Tiers[FeeStandard].GasPrice.Int64() != 20*gwei || estimate.Tiers[FeeFast].GasPrice.Int64() != 25*gwei {
+		t.Fatalf("unexpected gas price %s %s", estimate.Tiers[FeeStandard].GasPrice, estimate.Tiers[FeeFast].GasPrice)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"eth-relay/model"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// finalizedTracker 缓存节点的 finalized 区块号，判断数据是否已经不会再被回滚
+type finalizedTracker struct {
+	lock        sync.Mutex
+	number      *big.Int
+	updatedAt   time.Time // 最近一次请求节点的时间，失败时也会更新，避免每次调用都重试
+	unsupported bool      // 节点不认识 finalized 标签（旧版本节点），此时不缓存任何依赖区块的数据
+	refreshing  bool      // 正在请求节点，其他调用直接使用旧值
+}
+
+const finalizedRefreshInterval = 30 * time.Second
+
+// isFinalized 判断区块号是否不大于节点当前的 finalized 区块
+func (r *ETHRPCRequester) isFinalized(ctx context.Context, blockNumber string) bool {
+	if r.finalized == nil || len(blockNumber) < 3 {
+		return false
+	}
+	number, ok := new(big.Int).SetString(blockNumber[2:], 16)
+	if !ok {
+		return false
+	}
+	finalized := r.finalizedNumber(ctx)
+	return finalized != nil && number.Cmp(finalized) <= 0
+}
+
+func (r *ETHRPCRequester) finalizedNumber(ctx context.Context) *big.Int {
+	t := r.finalized
+	t.lock.Lock()
+	if t.unsupported || t.refreshing || time.Since(t.updatedAt) < finalizedRefreshInterval {
+		number := t.number
+		t.lock.Unlock()
+		return number
+	}
+	t.refreshing = true
+	t.lock.Unlock()
+
+	// 请求节点时不持有锁，避免慢节点阻塞所有缓存读写
+	header := model.Header{}
+	err := r.client.CallContext(ctx, &header, "eth_getBlockByNumber", "finalized", false)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.refreshing = false
+	t.updatedAt = time.Now()
+	if err != nil || len(header.Number) < 3 {
+		// 返回 null 或者其他错误（比如合并前的链还没有 finalized 区块）时保留旧值，过一段时间再试
+		if isFinalizedTagRejected(err) {
+			t.unsupported = true
+		}
+		return t.number
+	}
+	t.number, _ = new(big.Int).SetString(header.Number[2:], 16)
+	return t.number
+}
+
+// isFinalizedTagRejected 节点没有 eth_getBlockByNumber 方法，或者不认识 finalized 标签
+func isFinalizedTagRejected(err error) bool {
+	if isMethodUnsupported(err) {
+		return true
+	}
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32602 // invalid params
+}
+
+// cacheTransaction 只缓存已经被 finalized 区块打包的交易
+func (r *ETHRPCRequester) cacheTransaction(ctx context.Context, tx *model.Transaction) {
+	if r.cache == nil || tx.BlockHash == "" || !r.isFinalized(ctx, tx.BlockNumber) {
+		return
+	}
+	r.cache.Put(txKey(tx.Hash), tx.BlockHash, tx)
+}
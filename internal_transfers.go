@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"eth-relay/model"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// callTracerConfig debug_trace* 使用 geth 内置的 callTracer
+var callTracerConfig = map[string]string{"tracer": "callTracer"}
+
+// InternalTransfer 合约执行过程中产生的 ETH 转账，不包括交易本身的 Value
+type InternalTransfer struct {
+	TxHash       string
+	From         string
+	To           string
+	Value        *big.Int
+	CallType     string // 小写的调用类型：call、create、create2、selfdestruct
+	Depth        int    // 调用深度，交易的顶层调用为 0，所以内部转账从 1 开始
+	TraceAddress []int  // 在调用树中的路径，与 trace_* 的 traceAddress 相同
+	Error        string // 该调用自身的错误
+	Reverted     bool   // 该调用或者它的某个上层调用失败，转账没有生效
+}
+
+// GetInternalTransfers 追踪交易的调用树，返回生效的内部 ETH 转账。
+// 节点支持 debug_traceTransaction 时使用 callTracer，否则使用 trace_transaction
+func (r *ETHRPCRequester) GetInternalTransfers(txHash string) ([]InternalTransfer, error) {
+	return r.GetInternalTransfersContext(context.Background(), txHash)
+}
+
+func (r *ETHRPCRequester) GetInternalTransfersContext(ctx context.Context, txHash string) ([]InternalTransfer, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	return r.traceTransfers(ctx, []string{"debug_traceTransaction", "trace_transaction"}, func(method string) ([]InternalTransfer, error) {
+		if method == "trace_transaction" {
+			var traces []model.ParityTrace
+			if err := r.client.CallContext(ctx, &traces, method, txHash); err != nil {
+				return nil, err
+			}
+			if traces == nil {
+				return nil, fmt.Errorf("transaction %s not found", txHash)
+			}
+			return FlattenParityTraces(traces), nil
+		}
+		frame := &model.CallFrame{}
+		if err := r.client.CallContext(ctx, frame, method, txHash, callTracerConfig); err != nil {
+			return nil, err
+		}
+		return FlattenCallFrame(txHash, frame), nil
+	})
+}
+
+// GetBlockInternalTransfers 追踪区块内所有交易，返回生效的内部 ETH 转账，按交易顺序排列。
+// 节点支持 debug_traceBlockByNumber 时使用 callTracer，否则使用 trace_block
+func (r *ETHRPCRequester) GetBlockInternalTransfers(blockNumber *big.Int) ([]InternalTransfer, error) {
+	return r.GetBlockInternalTransfersContext(context.Background(), blockNumber)
+}
+
+func (r *ETHRPCRequester) GetBlockInternalTransfersContext(ctx context.Context, blockNumber *big.Int) ([]InternalTransfer, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	number := fmt.Sprintf("%#x", blockNumber)
+	return r.traceTransfers(ctx, []string{"debug_traceBlockByNumber", "trace_block"}, func(method string) ([]InternalTransfer, error) {
+		if method == "trace_block" {
+			var traces []model.ParityTrace
+			if err := r.client.CallContext(ctx, &traces, method, number); err != nil {
+				return nil, err
+			}
+			if traces == nil {
+				return nil, fmt.Errorf("block %s not found", number)
+			}
+			return FlattenParityTraces(traces), nil
+		}
+		var results []model.BlockTraceResult
+		if err := r.client.CallContext(ctx, &results, method, number, callTracerConfig); err != nil {
+			return nil, err
+		}
+		if err := r.fillTraceTxHashes(ctx, blockNumber, results); err != nil {
+			return nil, err
+		}
+		var transfers []InternalTransfer
+		for _, res := range results {
+			if res.Error != "" {
+				return nil, fmt.Errorf("trace transaction %s failed %s", res.TxHash, res.Error)
+			}
+			transfers = append(transfers, FlattenCallFrame(res.TxHash, &res.Result)...)
+		}
+		return transfers, nil
+	})
+}
+
+// traceTransfers 按优先级使用节点支持的追踪方法，方法不存在时标记为不可用并换下一个；
+// 只返回没有被回滚的转账
+func (r *ETHRPCRequester) traceTransfers(ctx context.Context, candidates []string,
+	trace func(method string) ([]InternalTransfer, error)) ([]InternalTransfer, error) {
+	for len(candidates) > 0 {
+		method, ok := r.pickMethod(ctx, candidates...)
+		if !ok {
+			break
+		}
+		transfers, err := trace(method)
+		if err == nil {
+			return slices.DeleteFunc(transfers, func(t InternalTransfer) bool { return t.Reverted }), nil
+		}
+		if !isMethodUnsupported(err) {
+			return nil, err
+		}
+		r.markUnsupported(method, err)
+		candidates = candidates[slices.Index(candidates, method)+1:]
+	}
+	return nil, fmt.Errorf("node does not support call tracing")
+}
+
+// fillTraceTxHashes 较老的 geth 不返回 txHash，按下标从区块的交易列表补上
+func (r *ETHRPCRequester) fillTraceTxHashes(ctx context.Context, blockNumber *big.Int, results []model.BlockTraceResult) error {
+	if !slices.ContainsFunc(results, func(res model.BlockTraceResult) bool { return res.TxHash == "" }) {
+		return nil
+	}
+	fullBlock, err := r.GetBlockInfoByNumberContext(ctx, blockNumber)
+	if err != nil {
+		return err
+	}
+	if len(fullBlock.Transactions) != len(results) {
+		return fmt.Errorf("block %s has %d transactions but %d traces", blockNumber, len(fullBlock.Transactions), len(results))
+	}
+	for i := range results {
+		results[i].TxHash = fullBlock.Transactions[i].Hash
+	}
+	return nil
+}
+
+// FlattenCallFrame 把 callTracer 的调用树展开成转账记录，包括被回滚的调用。
+// 顶层调用就是交易本身，不算内部转账；DELEGATECALL、STATICCALL 不转移 ETH
+func FlattenCallFrame(txHash string, frame *model.CallFrame) []InternalTransfer {
+	var transfers []InternalTransfer
+	var walk func(frame *model.CallFrame, traceAddress []int, reverted bool)
+	walk = func(frame *model.CallFrame, traceAddress []int, reverted bool) {
+		reverted = reverted || frame.Error != ""
+		callType := strings.ToLower(frame.Type)
+		if len(traceAddress) > 0 && transfersValue(callType) {
+			if value := parseTraceValue(frame.Value); value.Sign() > 0 {
+				transfers = append(transfers, InternalTransfer{
+					TxHash:       txHash,
+					From:         frame.From,
+					To:           frame.To,
+					Value:        value,
+					CallType:     callType,
+					Depth:        len(traceAddress),
+					TraceAddress: slices.Clone(traceAddress),
+					Error:        frame.Error,
+					Reverted:     reverted,
+				})
+			}
+		}
+		for i := range frame.Calls {
+			walk(&frame.Calls[i], append(traceAddress, i), reverted)
+		}
+	}
+	walk(frame, []int{}, false)
+	return transfers
+}
+
+// FlattenParityTraces 把 trace_block、trace_transaction 的返回转换成转账记录，包括被回滚的调用。
+// 记录按深度优先的顺序排列，上层调用失败时它下面的所有调用都被回滚
+func FlattenParityTraces(traces []model.ParityTrace) []InternalTransfer {
+	var transfers []InternalTransfer
+	var failed [][]int // 当前交易中失败的调用
+	txHash := ""
+	for _, trace := range traces {
+		if trace.Type == "reward" {
+			continue
+		}
+		if trace.TransactionHash != txHash {
+			txHash, failed = trace.TransactionHash, nil
+		}
+		reverted := trace.Error != ""
+		for _, address := range failed {
+			if len(address) <= len(trace.TraceAddress) && slices.Equal(address, trace.TraceAddress[:len(address)]) {
+				reverted = true
+			}
+		}
+		if trace.Error != "" {
+			failed = append(failed, trace.TraceAddress)
+		}
+		if len(trace.TraceAddress) == 0 {
+			continue
+		}
+		transfer := InternalTransfer{
+			TxHash:       trace.TransactionHash,
+			From:         trace.Action.From,
+			To:           trace.Action.To,
+			Value:        parseTraceValue(trace.Action.Value),
+			CallType:     trace.Action.CallType,
+			Depth:        len(trace.TraceAddress),
+			TraceAddress: trace.TraceAddress,
+			Error:        trace.Error,
+			Reverted:     reverted,
+		}
+		switch trace.Type {
+		case "create":
+			transfer.CallType = "create"
+			if trace.Result != nil {
+				transfer.To = trace.Result.Address
+			}
+		case "suicide":
+			transfer.CallType = "selfdestruct"
+			transfer.From, transfer.To = trace.Action.Address, trace.Action.RefundAddress
+			transfer.Value = parseTraceValue(trace.Action.Balance)
+		}
+		if transfersValue(transfer.CallType) && transfer.Value.Sign() > 0 {
+			transfers = append(transfers, transfer)
+		}
+	}
+	return transfers
+}
+
+// transfersValue 调用类型是否会把 ETH 转给另一个地址。CALLCODE 的 value 转给调用方自己，也不算
+func transfersValue(callType string) bool {
+	switch callType {
+	case "call", "create", "create2", "selfdestruct":
+		return true
+	}
+	return false
+}
+
+// parseTraceValue 没有 value 字段或者无法解析时为 0
+func parseTraceValue(hex string) *big.Int {
+	value, ok := new(big.Int).SetString(strings.TrimPrefix(hex, "0x"), 16)
+	if !ok {
+		return new(big.Int)
+	}
+	return value
+}
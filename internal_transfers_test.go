@@ -0,0 +1,111 @@
+package main
+
+import (
+	"eth-relay/model"
+	"math/big"
+	"testing"
+)
+
+// 顶层调用转出 1，内部依次：成功的 CALL、DELEGATECALL、失败的 CALL（其中的子调用被回滚）、CREATE 以及新合约自毁
+var testCallFrame = model.CallFrame{
+	Type: "CALL", From: "0xaa", To: "0x01", Value: "0x1",
+	Calls: []model.CallFrame{
+		{Type: "CALL", From: "0x01", To: "0xb1", Value: "0x5"},
+		{Type: "DELEGATECALL", From: "0x01", To: "0x02", Value: "0x5"},
+		{Type: "CALL", From: "0x01", To: "0x03", Value: "0x0", Error: "execution reverted", Calls: []model.CallFrame{
+			{Type: "CALL", From: "0x03", To: "0xb2", Value: "0x7"},
+		}},
+		{Type: "CREATE", From: "0x01", To: "0x04", Value: "0x3", Calls: []model.CallFrame{
+			{Type: "SELFDESTRUCT", From: "0x04", To: "0xb3", Value: "0x3"},
+			{Type: "STATICCALL", From: "0x04", To: "0x05"},
+		}},
+	},
+}
+
+// 与 testCallFrame 相同的交易，外加一条区块奖励
+var testParityTraces = []model.ParityTrace{
+	{Type: "call", Action: model.ParityTraceAction{CallType: "call", From: "0xaa", To: "0x01", Value: "0x1"}, TraceAddress: []int{}, TransactionHash: "0xt1"},
+	{Type: "call", Action: model.ParityTraceAction{CallType: "call", From: "0x01", To: "0xb1", Value: "0x5"}, TraceAddress: []int{0}, TransactionHash: "0xt1"},
+	{Type: "call", Action: model.ParityTraceAction{CallType: "delegatecall", From: "0x01", To: "0x02", Value: "0x5"}, TraceAddress: []int{1}, TransactionHash: "0xt1"},
+	{Type: "call", Action: model.ParityTraceAction{CallType: "call", From: "0x01", To: "0x03", Value: "0x0"}, Error: "Reverted", TraceAddress: []int{2}, TransactionHash: "0xt1"},
+	{Type: "call", Action: model.ParityTraceAction{CallType: "call", From: "0x03", To: "0xb2", Value: "0x7"}, TraceAddress: []int{2, 0}, TransactionHash: "0xt1"},
+	{Type: "create", Action: model.ParityTraceAction{From: "0x01", Value: "0x3"}, Result: &model.ParityTraceResult{Address: "0x04"}, TraceAddress: []int{3}, TransactionHash: "0xt1"},
+	{Type: "suicide", Action: model.ParityTraceAction{Address: "0x04", RefundAddress: "0xb3", Balance: "0x3"}, TraceAddress: []int{3, 0}, TransactionHash: "0xt1"},
+	{Type: "reward", Action: model.ParityTraceAction{Value: "0x10"}, TraceAddress: []int{}},
+}
+
+func checkTestTransfers(t *testing.T, transfers []InternalTransfer) {
+	expected := []InternalTransfer{
+		{From: "0x01", To: "0xb1", Value: big.NewInt(5), CallType: "call", Depth: 1},
+		{From: "0x01", To: "0x04", Value: big.NewInt(3), CallType: "create", Depth: 1},
+		{From: "0x04", To: "0xb3", Value: big.NewInt(3), CallType: "selfdestruct", Depth: 2},
+	}
+	if len(transfers) != len(expected) {
+		t.Fatalf("expected %d transfers, got %+v", len(expected), transfers)
+	}
+	for i, e := range expected {
+		got := transfers[i]
+		if got.TxHash != "0xt1" || got.From != e.From || got.To != e.To || got.Value.Cmp(e.Value) != 0 ||
+			got.CallType != e.CallType || got.Depth != e.Depth || got.Reverted {
+			t.Fatalf("unexpected transfer %d %+v", i, got)
+		}
+	}
+}
+
+func TestFlattenCallFrame(t *testing.T) {
+	transfers := FlattenCallFrame("0xt1", &testCallFrame)
+	// 包括被回滚的子调用
+	if len(transfers) != 4 || !transfers[1].Reverted || transfers[1].Error != "" || transfers[1].Value.Int64() != 7 {
+		t.Fatalf("unexpected transfers %+v", transfers)
+	}
+	if len(transfers[1].TraceAddress) != 2 || transfers[1].TraceAddress[0] != 2 || transfers[1].TraceAddress[1] != 0 {
+		t.Fatalf("unexpected trace address %v", transfers[1].TraceAddress)
+	}
+
+	transfers = FlattenParityTraces(testParityTraces)
+	if len(transfers) != 4 || !transfers[1].Reverted || transfers[1].Value.Int64() != 7 {
+		t.Fatalf("unexpected transfers %+v", transfers)
+	}
+}
+
+type debugTraceService struct{}
+
+func (s *debugTraceService) TraceTransaction(txHash string, config map[string]string) model.CallFrame {
+	return testCallFrame
+}
+
+func (s *debugTraceService) TraceBlockByNumber(number string, config map[string]string) []model.BlockTraceResult {
+	return []model.BlockTraceResult{{TxHash: "0xt1", Result: testCallFrame}}
+}
+
+type parityTraceService struct{}
+
+func (s *parityTraceService) Block(number string) []model.ParityTrace {
+	return testParityTraces
+}
+
+func TestETHRPCRequester_GetInternalTransfers(t *testing.T) {
+	requester := newFakeRequester(t, "debug", &debugTraceService{}, nil)
+	transfers, err := requester.GetInternalTransfers("0xt1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestTransfers(t, transfers)
+	transfers, err = requester.GetBlockInternalTransfers(big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestTransfers(t, transfers)
+
+	// 节点没有 debug 接口时使用 trace_block
+	requester = newFakeRequester(t, "trace", &parityTraceService{}, nil)
+	transfers, err = requester.GetBlockInternalTransfers(big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestTransfers(t, transfers)
+	// 两种接口都没有
+	if _, err := requester.GetInternalTransfers("0xt1"); err == nil {
+		t.Fatal("expected unsupported error")
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"eth-relay/model"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// maxLogTopics eth_getLogs 最多支持 4 个 topic 位置
+const maxLogTopics = 4
+
+// LogFilterBuilder 构造 eth_getLogs 的过滤条件
+type LogFilterBuilder struct {
+	filter model.LogFilter
+	err    error
+}
+
+func NewLogFilterBuilder() *LogFilterBuilder {
+	return &LogFilterBuilder{}
+}
+
+// Addresses 只查询这些合约的日志，多次调用会追加
+func (b *LogFilterBuilder) Addresses(addresses ...string) *LogFilterBuilder {
+	for _, address := range addresses {
+		if !common.IsHexAddress(address) {
+			b.setErr(fmt.Errorf("invalid address %q", address))
+			continue
+		}
+		b.filter.Address = append(b.filter.Address, address)
+	}
+	return b
+}
+
+// Topic 设置第 position 个 topic 位置，topics 之间为 OR；没有设置的位置匹配任意值
+func (b *LogFilterBuilder) Topic(position int, topics ...string) *LogFilterBuilder {
+	if position < 0 || position >= maxLogTopics {
+		b.setErr(fmt.Errorf("invalid topic position %d", position))
+		return b
+	}
+	for _, topic := range topics {
+		if len(topic) != 66 || !strings.HasPrefix(topic, "0x") {
+			b.setErr(fmt.Errorf("invalid topic %q", topic))
+			return b
+		}
+	}
+	for len(b.filter.Topics) <= position {
+		b.filter.Topics = append(b.filter.Topics, nil)
+	}
+	b.filter.Topics[position] = append(b.filter.Topics[position], topics...)
+	return b
+}
+
+// BlockRange 查询 [from, to] 区间的区块，nil 表示 latest
+func (b *LogFilterBuilder) BlockRange(from, to *big.Int) *LogFilterBuilder {
+	if from != nil && to != nil && from.Cmp(to) > 0 {
+		b.setErr(fmt.Errorf("invalid block range %s - %s", from, to))
+		return b
+	}
+	b.filter.FromBlock = blockTag(from)
+	b.filter.ToBlock = blockTag(to)
+	return b
+}
+
+// BlockTags 使用 earliest、latest、safe、finalized 等标签指定区间
+func (b *LogFilterBuilder) BlockTags(from, to string) *LogFilterBuilder {
+	b.filter.FromBlock = from
+	b.filter.ToBlock = to
+	return b
+}
+
+// BlockHash 只查询某个区块，与区间互斥
+func (b *LogFilterBuilder) BlockHash(blockHash string) *LogFilterBuilder {
+	b.filter.BlockHash = blockHash
+	return b
+}
+
+func (b *LogFilterBuilder) Build() (model.LogFilter, error) {
+	if b.err != nil {
+		return model.LogFilter{}, b.err
+	}
+	if b.filter.BlockHash != "" && (b.filter.FromBlock != "" || b.filter.ToBlock != "") {
+		return model.LogFilter{}, errors.New("block hash can not be used together with block range")
+	}
+	return b.filter, nil
+}
+
+func (b *LogFilterBuilder) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+func blockTag(number *big.Int) string {
+	if number == nil {
+		return "latest"
+	}
+	return fmt.Sprintf("%#x", number)
+}
+
+// GetLogs 按过滤条件查询日志。节点因为结果太多或者区间太大拒绝查询时，把区间对半拆分后重试，结果按区块顺序合并
+func (r *ETHRPCRequester) GetLogs(filter model.LogFilter) ([]model.Log, error) {
+	return r.GetLogsContext(context.Background(), filter)
+}
+
+func (r *ETHRPCRequester) GetLogsContext(ctx context.Context, filter model.LogFilter) ([]model.Log, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	logs, err := r.getLogs(ctx, filter)
+	if err == nil || filter.BlockHash != "" || !isLogQueryTooLarge(err) {
+		return logs, err
+	}
+	// 标签在拆分过程中可能指向不同的区块，先固定成区块号
+	from, err := r.resolveBlockTag(ctx, filter.FromBlock)
+	if err != nil {
+		return nil, err
+	}
+	to, err := r.resolveBlockTag(ctx, filter.ToBlock)
+	if err != nil {
+		return nil, err
+	}
+	return r.getLogsBisect(ctx, filter, from, to)
+}
+
+func (r *ETHRPCRequester) getLogsBisect(ctx context.Context, filter model.LogFilter, from, to *big.Int) ([]model.Log, error) {
+	filter.FromBlock = fmt.Sprintf("%#x", from)
+	filter.ToBlock = fmt.Sprintf("%#x", to)
+	logs, err := r.getLogs(ctx, filter)
+	if err == nil || !isLogQueryTooLarge(err) {
+		return logs, err
+	}
+	if from.Cmp(to) >= 0 {
+		return nil, fmt.Errorf("logs of block %s exceed the provider limit: %s", from, err.Error())
+	}
+	mid := new(big.Int).Add(from, to)
+	mid.Rsh(mid, 1)
+	left, err := r.getLogsBisect(ctx, filter, from, mid)
+	if err != nil {
+		return nil, err
+	}
+	right, err := r.getLogsBisect(ctx, filter, new(big.Int).Add(mid, big.NewInt(1)), to)
+	if err != nil {
+		return nil, err
+	}
+	return append(left, right...), nil
+}
+
+func (r *ETHRPCRequester) getLogs(ctx context.Context, filter model.LogFilter) ([]model.Log, error) {
+	var logs []model.Log
+	if err := r.client.CallContext(ctx, &logs, "eth_getLogs", filter); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// resolveBlockTag 把区块号或者标签转成区块号，空字符串按 latest 处理
+func (r *ETHRPCRequester) resolveBlockTag(ctx context.Context, tag string) (*big.Int, error) {
+	switch tag {
+	case "earliest":
+		return big.NewInt(0), nil
+	case "", "latest":
+		return r.GetLastestBlockNumberContext(ctx)
+	}
+	if strings.HasPrefix(tag, "0x") {
+		number, ok := new(big.Int).SetString(tag[2:], 16)
+		if !ok {
+			return nil, fmt.Errorf("invalid block number %q", tag)
+		}
+		return number, nil
+	}
+	header := model.Header{}
+	if err := r.client.CallContext(ctx, &header, "eth_getBlockByNumber", tag, false); err != nil {
+		return nil, err
+	}
+	if header.Number == "" {
+		return nil, fmt.Errorf("block %s not found", tag)
+	}
+	number, _ := new(big.Int).SetString(header.Number[2:], 16)
+	return number, nil
+}
+
+// isLogQueryTooLarge 各家节点对结果数量、区间大小的限制报错不统一，按错误码和关键字判断
+func isLogQueryTooLarge(err error) bool {
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	if rpcErr.ErrorCode() == -32005 { // limit exceeded
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, keyword := range []string{
+		"more than", "too many", "too large", "too wide", "range is too", "exceed", "limited to", "response size",
+	} {
+		if strings.Contains(msg, keyword) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"eth-relay/model"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"testing"
+)
+
+type limitExceededError struct{}
+
+func (e *limitExceededError) Error() string  { return "query returned more than 10000 results" }
+func (e *limitExceededError) ErrorCode() int { return -32005 }
+
+// logService 每个区块一条日志，区间超过 maxRange 个区块时拒绝查询
+type logService struct {
+	latest   int64
+	maxRange int64
+	calls    int32
+}
+
+func (s *logService) BlockNumber() string {
+	return fmt.Sprintf("%#x", s.latest)
+}
+
+func (s *logService) GetLogs(filter model.LogFilter) ([]model.Log, error) {
+	atomic.AddInt32(&s.calls, 1)
+	from := big.NewInt(0)
+	if filter.FromBlock != "earliest" {
+		from, _ = new(big.Int).SetString(filter.FromBlock[2:], 16)
+	}
+	to := big.NewInt(s.latest)
+	if filter.ToBlock != "latest" {
+		to, _ = new(big.Int).SetString(filter.ToBlock[2:], 16)
+	}
+	if to.Int64()-from.Int64()+1 > s.maxRange {
+		return nil, &limitExceededError{}
+	}
+	var logs []model.Log
+	for i := from.Int64(); i <= to.Int64(); i++ {
+		logs = append(logs, model.Log{BlockNumber: fmt.Sprintf("%#x", i), Address: filter.Address[0]})
+	}
+	return logs, nil
+}
+
+func TestETHRPCRequester_GetLogsBisect(t *testing.T) {
+	service := &logService{latest: 20, maxRange: 4}
+	requester := newFakeRequester(t, "eth", service, nil)
+
+	contract := "0xc6e7DF5E7b4f2A278906862b61205850344D4e7d"
+	filter, err := NewLogFilterBuilder().
+		Addresses(contract).
+		Topic(0, "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef").
+		BlockTags("earliest", "latest").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, err := requester.GetLogs(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 21 {
+		t.Fatalf("expected 21 logs, got %d", len(logs))
+	}
+	for i, log := range logs {
+		if log.BlockNumber != fmt.Sprintf("%#x", i) {
+			t.Fatalf("logs out of order at %d: %s", i, log.BlockNumber)
+		}
+	}
+	fmt.Println("eth_getLogs calls", atomic.LoadInt32(&service.calls))
+}
+
+func TestLogFilterBuilder_Build(t *testing.T) {
+	filter, err := NewLogFilterBuilder().
+		Topic(2, "0x000000000000000000000000ee9a7e064ddddb8db82bb5cef9e884409e7273fe").
+		BlockRange(big.NewInt(10), big.NewInt(20)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filter.Topics) != 3 || filter.Topics[0] != nil || filter.Topics[1] != nil || len(filter.Topics[2]) != 1 {
+		t.Fatalf("unexpected topics %v", filter.Topics)
+	}
+	if filter.FromBlock != "0xa" || filter.ToBlock != "0x14" {
+		t.Fatalf("unexpected range %s - %s", filter.FromBlock, filter.ToBlock)
+	}
+
+	if _, err := NewLogFilterBuilder().BlockRange(big.NewInt(2), big.NewInt(1)).Build(); err == nil {
+		t.Fatal("expected error for reversed range")
+	}
+	if _, err := NewLogFilterBuilder().BlockHash("0xaa").BlockTags("earliest", "latest").Build(); err == nil {
+		t.Fatal("expected error for block hash with range")
+	}
+	if _, err := NewLogFilterBuilder().Topic(4, "0x00").Build(); err == nil {
+		t.Fatal("expected error for invalid topic position")
+	}
+}
@@ -1,16 +1,32 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"eth-relay/dao"
 )
 
 func main() {
 	// ---------- 1. 命令行参数 ----------
-	rpcURL := flag.String("rpc", "", "Ethereum JSON-RPC endpoint (http/https)")
+	rpcURL := flag.String("rpc", "", "Ethereum JSON-RPC endpoints (http/https/ws/wss/ipc), comma separated")
+	rateLimit := flag.Float64("rate-limit", 0, "max rpc credits per second, 0 means unlimited")
+	creditBudget := flag.Float64("credit-budget", 0, "rpc credit budget per period of this process, reset on restart, 0 means unlimited")
+	budgetPeriod := flag.String("budget-period", "daily", "credit budget period: daily or monthly")
+	rpcHeaders := flag.String("rpc-headers", "", "extra rpc request headers, e.g. \"Authorization: Bearer xxx; X-Api-Key: yyy\"")
+	jwtSecret := flag.String("jwt-secret", "", "path to the hex encoded jwt secret used by geth authrpc")
+	maxBatchSize := flag.Int("max-batch-size", 100, "split rpc batches larger than this size")
+	cacheSize := flag.Int("cache-size", 10000, "max entries of the in-memory rpc response cache, 0 disables the cache")
+	cacheDir := flag.String("cache-dir", "", "directory to persist the rpc response cache")
+	cacheDiskEntries := flag.Int("cache-disk-entries", 100000, "max entries of the rpc response cache kept in cache-dir")
+	multicall := flag.String("multicall", "", "Multicall3 address used to aggregate token queries, \"default\" for "+DefaultMulticall3Address)
+	maxHeadLag := flag.Uint64("max-head-lag", 5, "mark an endpoint as stale when it is this many blocks behind the best one")
 	mysqlDSN := flag.String("mysql", "", "MySQL DSN, e.g. root:123@tcp(127.0.0.1:3306)/eth_relay?charset=utf8mb4")
 	flag.Parse()
 
@@ -21,6 +37,12 @@ func main() {
 	if *mysqlDSN == "" {
 		*mysqlDSN = os.Getenv("MYSQL_DSN")
 	}
+	if *rpcHeaders == "" {
+		*rpcHeaders = os.Getenv("ETH_RPC_HEADERS")
+	}
+	if *jwtSecret == "" {
+		*jwtSecret = os.Getenv("ETH_RPC_JWT_SECRET")
+	}
 
 	// ---------- 3. 参数校验 ----------
 	if *rpcURL == "" {
@@ -33,6 +55,15 @@ func main() {
 		flag.Usage()
 		os.Exit(1)
 	}
+	if period := BudgetPeriod(*budgetPeriod); period != BudgetDaily && period != BudgetMonthly {
+		fmt.Println("Error: --budget-period must be daily or monthly, got", *budgetPeriod)
+		os.Exit(1)
+	}
+	headers, err := ParseHeaders(*rpcHeaders)
+	if err != nil {
+		fmt.Println("Error: invalid --rpc-headers:", err)
+		os.Exit(1)
+	}
 
 	// ---------- 4. 初始化组件 ----------
 	// MySQL
@@ -44,11 +75,61 @@ func main() {
 		ShowSqlLog:         false,
 		TablePrefix:        "eth_",
 	}
-	tables := []interface{}{dao.Block{}, dao.Transaction{}}
+	tables := []interface{}{dao.Block{}, dao.Transaction{}, dao.Metadata{}}
 	mysqlConn := dao.NewMqSQLConnector(&mysqlOpt, tables)
 
 	// ETH RPC
-	requester := NewETHRPCRequester(*rpcURL)
+	clientOpt := ClientOptions{
+		NodeUrls:      strings.Split(*rpcURL, ","),
+		MaxHeadLag:    *maxHeadLag,
+		Headers:       headers,
+		JWTSecretFile: *jwtSecret,
+		MaxBatchSize:  *maxBatchSize,
+	}
+	if *cacheSize > 0 {
+		clientOpt.Cache = &CacheOptions{
+			MaxEntries:     *cacheSize,
+			DiskDir:        *cacheDir,
+			MaxDiskEntries: *cacheDiskEntries,
+		}
+	}
+	if *multicall == "default" {
+		clientOpt.Multicall = &MulticallOptions{}
+	} else if *multicall != "" {
+		clientOpt.Multicall = &MulticallOptions{Address: *multicall}
+	}
+	if *rateLimit > 0 || *creditBudget > 0 {
+		clientOpt.RateLimit = &RateLimitOptions{
+			CreditsPerSecond: *rateLimit,
+			Budget:           *creditBudget,
+			BudgetPeriod:     BudgetPeriod(*budgetPeriod),
+		}
+	}
+	requester, err := NewETHRPCRequesterWithOptions(&clientOpt)
+	if err != nil {
+		fmt.Println("RPC client init failed:", err)
+		os.Exit(1)
+	}
+
+	// 确认节点和数据库是同一条链
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	identity, err := CheckChainIdentity(ctx, requester, mysqlConn)
+	cancel()
+	if err != nil {
+		fmt.Println("Chain identity check failed:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Chain id %s, genesis %s\n", identity.ChainId, identity.GenesisHash)
+
+	// 探测节点支持的可选方法，失败时不影响启动，使用时再探测
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	caps, err := requester.ProbeCapabilities(ctx)
+	cancel()
+	if err != nil {
+		fmt.Println("Probe node capabilities failed:", err)
+	} else {
+		fmt.Printf("Node %s, archive %v, optional methods %v\n", caps.ClientVersion, caps.ArchiveState, caps.SupportedMethods())
+	}
 
 	// Scanner
 	scanner := NewBlockScanner(*requester, mysqlConn)
@@ -59,6 +140,9 @@ func main() {
 		os.Exit(1)
 	}
 
-	// 阻塞主 goroutine
-	select {}
+	// 阻塞主 goroutine，收到退出信号后停止扫描
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	scanner.Stop()
 }
@@ -0,0 +1,9 @@
+package model
+
+// FeeHistory eth_feeHistory 的返回值
+type FeeHistory struct {
+	OldestBlock   string     `json:"oldestBlock"`
+	BaseFeePerGas []string   `json:"baseFeePerGas"` // 比查询的区块多一个，最后一个是下一个区块的 base fee
+	GasUsedRatio  []float64  `json:"gasUsedRatio"`
+	Reward        [][]string `json:"reward"` // 每个区块按请求的百分位统计的小费
+}
@@ -10,7 +10,8 @@ type FullBlock struct {
 	Sha3Uncles       string            `json:"sha3Uncles"`
 	LogsBloom        string            `json:"logsBloom"`
 	TransactionsRoot string            `json:"transactionsRoot"`
-	ReceiptsRoot     string            `json:"stateRoot"`
+	StateRoot        string            `json:"stateRoot"`
+	ReceiptsRoot     string            `json:"receiptsRoot"`
 	Miner            string            `json:"miner"`
 	Difficulty       string            `json:"difficulty"`
 	TotalDifficulty  string            `json:"totalDifficulty"`
@@ -0,0 +1,20 @@
+package model
+
+type Header struct {
+	Number           string `json:"number"`
+	Hash             string `json:"hash"`
+	ParentHash       string `json:"parentHash"`
+	Nonce            string `json:"nonce"`
+	Sha3Uncles       string `json:"sha3Uncles"`
+	LogsBloom        string `json:"logsBloom"`
+	TransactionsRoot string `json:"transactionsRoot"`
+	StateRoot        string `json:"stateRoot"`
+	ReceiptsRoot     string `json:"receiptsRoot"`
+	Miner            string `json:"miner"`
+	Difficulty       string `json:"difficulty"`
+	ExtraData        string `json:"extraData"`
+	GasLimit         string `json:"gasLimit"`
+	GasUsed          string `json:"gasUsed"`
+	Timestamp        string `json:"timestamp"`
+	BaseFeePerGas    string `json:"baseFeePerGas"`
+}
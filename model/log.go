@@ -0,0 +1,21 @@
+package model
+
+type Log struct {
+	Address          string   `json:"address"`
+	Topics           []string `json:"topics"`
+	Data             string   `json:"data"`
+	BlockNumber      string   `json:"blockNumber"`
+	BlockHash        string   `json:"blockHash"`
+	TransactionHash  string   `json:"transactionHash"`
+	TransactionIndex string   `json:"transactionIndex"`
+	LogIndex         string   `json:"logIndex"`
+	Removed          bool     `json:"removed"`
+}
+
+type LogFilter struct {
+	Address   []string   `json:"address,omitempty"`   // 合约地址，多个之间为 OR
+	Topics    [][]string `json:"topics,omitempty"`    // 每个位置的 topic，nil 表示任意，同一位置多个之间为 OR
+	FromBlock string     `json:"fromBlock,omitempty"` // 起始区块号（十六进制）或者 latest 等标签，包含
+	ToBlock   string     `json:"toBlock,omitempty"`   // 结束区块号（十六进制）或者 latest 等标签，包含
+	BlockHash string     `json:"blockHash,omitempty"` // 只查询该区块，不能和 FromBlock、ToBlock 同时使用
+}
@@ -0,0 +1,18 @@
+package model
+
+// AccountProof eth_getProof 的返回，数值字段为十六进制字符串
+type AccountProof struct {
+	Address      string         `json:"address"`
+	AccountProof []string       `json:"accountProof"` // 从状态树根节点到账户的 rlp 编码节点
+	Balance      string         `json:"balance"`
+	CodeHash     string         `json:"codeHash"`
+	Nonce        string         `json:"nonce"`
+	StorageHash  string         `json:"storageHash"` // 账户存储树的根
+	StorageProof []StorageProof `json:"storageProof"`
+}
+
+type StorageProof struct {
+	Key   string   `json:"key"`
+	Value string   `json:"value"`
+	Proof []string `json:"proof"` // 从存储树根节点到该存储槽的 rlp 编码节点
+}
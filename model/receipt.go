@@ -0,0 +1,24 @@
+package model
+
+type Receipt struct {
+	TransactionHash   string `json:"transactionHash"`
+	TransactionIndex  string `json:"transactionIndex"`
+	BlockHash         string `json:"blockHash"`
+	BlockNumber       string `json:"blockNumber"`
+	From              string `json:"from"`
+	To                string `json:"to"`                // 创建合约的交易为空
+	Type              string `json:"type"`              // 交易类型，0x0 legacy，0x1 EIP-2930，0x2 EIP-1559 ...
+	Status            string `json:"status"`            // 0x1 成功，0x0 失败；拜占庭分叉之前的区块为空，使用 Root
+	Root              string `json:"root"`              // 拜占庭分叉之前的交易执行后的 state root
+	GasUsed           string `json:"gasUsed"`           // 本交易消耗的 gas
+	CumulativeGasUsed string `json:"cumulativeGasUsed"` // 区块内截止到本交易累计消耗的 gas
+	EffectiveGasPrice string `json:"effectiveGasPrice"` // 实际支付的 gas 单价
+	ContractAddress   string `json:"contractAddress"`   // 创建的合约地址
+	LogsBloom         string `json:"logsBloom"`
+	Logs              []Log  `json:"logs"`
+}
+
+// Succeeded 交易是否执行成功
+func (r *Receipt) Succeeded() bool {
+	return r.Status == "0x1"
+}
@@ -0,0 +1,56 @@
+package model
+
+// CallFrame geth callTracer 返回的调用树，数值字段为十六进制字符串
+type CallFrame struct {
+	Type         string      `json:"type"` // CALL、STATICCALL、DELEGATECALL、CALLCODE、CREATE、CREATE2、SELFDESTRUCT
+	From         string      `json:"from"`
+	To           string      `json:"to"`
+	Value        string      `json:"value"` // STATICCALL 没有该字段
+	Gas          string      `json:"gas"`
+	GasUsed      string      `json:"gasUsed"`
+	Input        string      `json:"input"`
+	Output       string      `json:"output"`
+	Error        string      `json:"error"`        // 调用失败时不为空，该调用及其子调用的状态修改全部回滚
+	RevertReason string      `json:"revertReason"` // 回滚数据能解析成 Error(string) 时的原因
+	Calls        []CallFrame `json:"calls"`
+}
+
+// BlockTraceResult debug_traceBlockByNumber 返回的一笔交易的调用树
+type BlockTraceResult struct {
+	TxHash string    `json:"txHash"` // 较老的 geth 版本没有该字段
+	Result CallFrame `json:"result"`
+	Error  string    `json:"error"` // 该交易追踪失败
+}
+
+// ParityTrace trace_block、trace_transaction 返回的扁平调用记录
+type ParityTrace struct {
+	Type                string             `json:"type"` // call、create、suicide、reward
+	Action              ParityTraceAction  `json:"action"`
+	Result              *ParityTraceResult `json:"result"`
+	Error               string             `json:"error"`
+	Subtraces           int                `json:"subtraces"`
+	TraceAddress        []int              `json:"traceAddress"` // 在调用树中的路径，顶层调用为空
+	TransactionHash     string             `json:"transactionHash"`
+	TransactionPosition int                `json:"transactionPosition"`
+	BlockHash           string             `json:"blockHash"`
+	BlockNumber         uint64             `json:"blockNumber"`
+}
+
+type ParityTraceAction struct {
+	CallType      string `json:"callType"` // type 为 call 时：call、staticcall、delegatecall、callcode
+	From          string `json:"from"`
+	To            string `json:"to"`
+	Value         string `json:"value"`
+	Gas           string `json:"gas"`
+	Input         string `json:"input"`
+	Init          string `json:"init"`          // type 为 create 时的初始化代码
+	Address       string `json:"address"`       // type 为 suicide 时自毁的合约
+	RefundAddress string `json:"refundAddress"` // type 为 suicide 时接收余额的地址
+	Balance       string `json:"balance"`       // type 为 suicide 时转出的余额
+}
+
+type ParityTraceResult struct {
+	GasUsed string `json:"gasUsed"`
+	Output  string `json:"output"`
+	Address string `json:"address"` // type 为 create 时创建的合约地址
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"eth-relay/tool"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// DefaultMulticall3Address 大部分链上 Multicall3 的部署地址
+const DefaultMulticall3Address = "0xcA11bde05977b3631167028862bE2a173976CA11"
+
+const multicall3Abi = `[{"type":"function","name":"aggregate3","stateMutability":"payable",` +
+	`"inputs":[{"name":"calls","type":"tuple[]","components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}]}],` +
+	`"outputs":[{"name":"returnData","type":"tuple[]","components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}]}]}]`
+
+var multicallAbi, _ = tool.ParseABI(multicall3Abi)
+
+type MulticallOptions struct {
+	Address    string // Multicall3 合约地址，默认 DefaultMulticall3Address
+	GasCap     uint64 // 单次 aggregate3 调用最多使用的 gas，需要小于节点的 RPCGasCap，默认 25000000
+	GasPerCall uint64 // 每个子调用预估使用的 gas，和 GasCap 一起决定每次打包多少个调用，默认 50000
+}
+
+// MulticallCall aggregate3 中的一个子调用，AllowFailure 为 false 时该调用失败会导致同一批的调用全部失败
+type MulticallCall struct {
+	Target       string
+	CallData     []byte
+	AllowFailure bool
+}
+
+// call3 与 aggregate3 参数中的 tuple 对应
+type call3 struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type call3Result struct {
+	Success    bool
+	ReturnData []byte
+}
+
+type multicaller struct {
+	options   MulticallOptions
+	address   common.Address
+	aggregate bool // ClientOptions.Multicall 不为 nil 时，代币查询等批量 eth_call 通过 aggregate3 发送
+	lock      sync.Mutex
+	deployed  *bool // nil 表示还没有检查过
+}
+
+func newMulticaller(options *MulticallOptions) *multicaller {
+	m := &multicaller{lock: sync.Mutex{}, aggregate: options != nil}
+	if options != nil {
+		m.options = *options
+	}
+	if m.options.Address == "" {
+		m.options.Address = DefaultMulticall3Address
+	}
+	if m.options.GasCap == 0 {
+		m.options.GasCap = 25000000
+	}
+	if m.options.GasPerCall == 0 {
+		m.options.GasPerCall = 50000
+	}
+	m.address = common.HexToAddress(m.options.Address)
+	return m
+}
+
+// Multicall 通过 Multicall3 的 aggregate3 执行多个 eth_call，结果与 calls 按下标一一对应。
+// 调用数量超过 GasCap/GasPerCall 时切分成多个 aggregate3，在同一个批量请求中发送；
+// 当前链上没有部署 Multicall3 时退回到普通的批量 eth_call
+func (r *ETHRPCRequester) Multicall(calls []MulticallCall) ([]BatchResult[hexutil.Bytes], error) {
+	return r.MulticallContext(context.Background(), calls)
+}
+
+func (r *ETHRPCRequester) MulticallContext(ctx context.Context, calls []MulticallCall) ([]BatchResult[hexutil.Bytes], error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	finalRes := make([]BatchResult[hexutil.Bytes], len(calls))
+	var tokenCalls []tokenCall
+	var allowFailure []bool
+	var indexes []int // tokenCalls 中每个调用对应 calls 的下标
+	for i, call := range calls {
+		if err := r.resolveAddressArgs(ctx, &call.Target); err != nil {
+			finalRes[i].Err = fmt.Errorf("invalid multicall target %w", err)
+			continue
+		}
+		tokenCalls = append(tokenCalls, tokenCall{to: common.HexToAddress(call.Target), data: call.CallData})
+		allowFailure = append(allowFailure, call.AllowFailure)
+		indexes = append(indexes, i)
+	}
+	if len(tokenCalls) == 0 {
+		return finalRes, nil
+	}
+	res, err := r.multicall(ctx, tokenCalls, allowFailure, "latest")
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range indexes {
+		finalRes[i] = res[j]
+	}
+	return finalRes, nil
+}
+
+func (r *ETHRPCRequester) multicall(ctx context.Context, calls []tokenCall, allowFailure []bool,
+	block interface{}) ([]BatchResult[hexutil.Bytes], error) {
+	deployed, err := r.multicallDeployed(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !deployed {
+		return r.plainBatchCall(ctx, calls, block)
+	}
+	chunkSize := int(max(r.multicaller.options.GasCap/r.multicaller.options.GasPerCall, 1))
+	var reqs []rpc.BatchElem
+	var resArr []*hexutil.Bytes
+	for start := 0; start < len(calls); start += chunkSize {
+		end := min(start+chunkSize, len(calls))
+		chunk := make([]call3, 0, end-start)
+		for i := start; i < end; i++ {
+			chunk = append(chunk, call3{Target: calls[i].to, AllowFailure: allowFailure[i], CallData: calls[i].data})
+		}
+		data, err := multicallAbi.Pack("aggregate3", chunk)
+		if err != nil {
+			return nil, fmt.Errorf("pack aggregate3 failed %s", err.Error())
+		}
+		res := &hexutil.Bytes{}
+		arg := map[string]interface{}{"to": r.multicaller.address, "data": hexutil.Bytes(data)}
+		reqs = append(reqs, rpc.BatchElem{Method: "eth_call", Args: []interface{}{arg, block}, Result: res})
+		resArr = append(resArr, res)
+	}
+	if err := r.client.BatchCallContext(ctx, reqs); err != nil {
+		return nil, err
+	}
+	finalRes := make([]BatchResult[hexutil.Bytes], len(calls))
+	for k, req := range reqs {
+		start := k * chunkSize
+		end := min(start+chunkSize, len(calls))
+		if req.Error == nil && len(*resArr[k]) == 0 {
+			// 查询的区块早于 Multicall3 的部署
+			res, err := r.plainBatchCall(ctx, calls[start:end], block)
+			if err != nil {
+				return nil, err
+			}
+			copy(finalRes[start:end], res)
+			continue
+		}
+		results, err := unpackAggregate3(*resArr[k], req.Error)
+		if err == nil && len(results) != end-start {
+			err = fmt.Errorf("aggregate3 returned %d results for %d calls", len(results), end-start)
+		}
+		for i := start; i < end; i++ {
+			switch {
+			case err != nil:
+				finalRes[i].Err = err
+			case !results[i-start].Success:
+				finalRes[i].Err = DecodeRevertData(results[i-start].ReturnData, "")
+			default:
+				finalRes[i].Value = results[i-start].ReturnData
+			}
+		}
+	}
+	return finalRes, nil
+}
+
+func unpackAggregate3(data []byte, callErr error) ([]call3Result, error) {
+	if callErr != nil {
+		// 不允许失败的子调用失败时整个 aggregate3 回滚
+		return nil, decodeRevert(callErr, "")
+	}
+	values, err := multicallAbi.Unpack("aggregate3", data)
+	if err != nil {
+		return nil, fmt.Errorf("unpack aggregate3 failed %s", err.Error())
+	}
+	return *abi.ConvertType(values[0], new([]call3Result)).(*[]call3Result), nil
+}
+
+// multicallDeployed 检查一次 Multicall3 地址上是否有合约代码，结果缓存。
+// 请求节点时不持有锁，并发的首次调用可能各自检查一次；出错时不缓存，下次重新检查
+func (r *ETHRPCRequester) multicallDeployed(ctx context.Context) (bool, error) {
+	m := r.multicaller
+	m.lock.Lock()
+	deployed := m.deployed
+	m.lock.Unlock()
+	if deployed != nil {
+		return *deployed, nil
+	}
+	code, err := r.getCode(ctx, m.address.Hex(), "latest")
+	if err != nil {
+		return false, err
+	}
+	hasCode := len(code) > 0
+	m.lock.Lock()
+	m.deployed = &hasCode
+	m.lock.Unlock()
+	return hasCode, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// multicallService 在 erc20Service 的基础上模拟部署在默认地址的 Multicall3
+type multicallService struct {
+	*erc20Service
+	deployed   bool
+	aggregates atomic.Int64
+}
+
+func (s *multicallService) GetCode(address common.Address, block string) hexutil.Bytes {
+	if s.deployed && address == common.HexToAddress(DefaultMulticall3Address) {
+		return hexutil.Bytes{0x60, 0x80}
+	}
+	return hexutil.Bytes{}
+}
+
+func (s *multicallService) Call(arg map[string]interface{}, block interface{}) (hexutil.Bytes, error) {
+	if common.HexToAddress(arg["to"].(string)) != common.HexToAddress(DefaultMulticall3Address) {
+		return s.erc20Service.Call(arg, block)
+	}
+	s.aggregates.Add(1)
+	data := common.FromHex(arg["data"].(string))
+	values, err := multicallAbi.Methods["aggregate3"].Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, err
+	}
+	calls := *abi.ConvertType(values[0], new([]call3)).(*[]call3)
+	var results []call3Result
+	for _, call := range calls {
+		if call.Target == bareToken && len(call.CallData) == 4 {
+			// bareToken 的 name、symbol、decimals 回滚
+			if !call.AllowFailure {
+				return nil, &revertError{data: "0x"}
+			}
+			results = append(results, call3Result{Success: false})
+			continue
+		}
+		res, err := s.erc20Service.Call(map[string]interface{}{
+			"to":   call.Target.Hex(),
+			"data": hexutil.Encode(call.CallData),
+		}, block)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, call3Result{Success: true, ReturnData: res})
+	}
+	return multicallAbi.Methods["aggregate3"].Outputs.Pack(results)
+}
+
+func newMulticallRequester(t *testing.T, service *multicallService, options *MulticallOptions) *ETHRPCRequester {
+	return newFakeRequester(t, "eth", service, &ClientOptions{Multicall: options})
+}
+
+func TestETHRPCRequester_MulticallBalances(t *testing.T) {
+	service := &multicallService{erc20Service: &erc20Service{}, deployed: true}
+	// 每个 aggregate3 最多打包 2 个调用
+	requester := newMulticallRequester(t, service, &MulticallOptions{GasCap: 100000, GasPerCall: 50000})
+	user := "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"
+	var params []ERC20BalanceRpcReq
+	for i := 0; i < 5; i++ {
+		params = append(params, ERC20BalanceRpcReq{ContractAddress: standardToken.Hex(), UserAddress: user})
+	}
+	params = append(params, ERC20BalanceRpcReq{ContractAddress: bareToken.Hex(), UserAddress: user, ContractDecimal: 2})
+	res, err := requester.GetERC20Balances(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, item := range res[:5] {
+		if item.Err != nil || item.Value != "1.5" {
+			t.Fatalf("unexpected balance %d %+v", i, item)
+		}
+	}
+	if res[5].Err != nil || res[5].Value != "15000" {
+		t.Fatalf("unexpected bare token balance %+v", res[5])
+	}
+	// 6 个余额分成 3 批，6 个 metadata 调用分成 3 批，bareToken 的 metadata 调用没有到达代币合约
+	if service.aggregates.Load() != 6 || service.calls.Load() != 9 {
+		t.Fatalf("unexpected call count: %d aggregate3, %d sub calls", service.aggregates.Load(), service.calls.Load())
+	}
+}
+
+func TestETHRPCRequester_MulticallNotAllowFailure(t *testing.T) {
+	service := &multicallService{erc20Service: &erc20Service{}, deployed: true}
+	requester := newMulticallRequester(t, service, nil)
+	decimals, _ := erc20Abi.Pack("decimals")
+	res, err := requester.MulticallContext(context.Background(), []MulticallCall{
+		{Target: standardToken.Hex(), CallData: decimals},
+		{Target: bareToken.Hex(), CallData: decimals},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var revert *ExecutionRevertedError
+	if !errors.As(res[0].Err, &revert) || !errors.As(res[1].Err, &revert) {
+		t.Fatalf("expected whole chunk to revert, got %+v", res)
+	}
+
+	res, err = requester.Multicall([]MulticallCall{
+		{Target: standardToken.Hex(), CallData: decimals},
+		{Target: bareToken.Hex(), CallData: decimals, AllowFailure: true},
+		{Target: "bad", CallData: decimals},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 地址不合法只影响该调用
+	if res[0].Err != nil || new(big.Int).SetBytes(res[0].Value).Int64() != 6 || res[1].Err == nil || res[2].Err == nil {
+		t.Fatalf("unexpected results %+v", res)
+	}
+}
+
+func TestETHRPCRequester_MulticallNotDeployed(t *testing.T) {
+	service := &multicallService{erc20Service: &erc20Service{}}
+	requester := newMulticallRequester(t, service, &MulticallOptions{})
+	res, err := requester.GetTotalSupplies([]string{standardToken.Hex()})
+	if err != nil || res[0].Value != "1.5" {
+		t.Fatalf("unexpected total supply %+v %v", res, err)
+	}
+	if service.aggregates.Load() != 0 {
+		t.Fatal("aggregate3 should not be used without Multicall3")
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"eth-relay/tool"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// ERC721Abi 查询用到的 ERC-721 方法
+const ERC721Abi = `[
+	{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"ownerOf","stateMutability":"view","inputs":[{"name":"tokenId","type":"uint256"}],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"tokenURI","stateMutability":"view","inputs":[{"name":"tokenId","type":"uint256"}],"outputs":[{"name":"","type":"string"}]},
+	{"type":"function","name":"supportsInterface","stateMutability":"view","inputs":[{"name":"interfaceId","type":"bytes4"}],"outputs":[{"name":"","type":"bool"}]}
+]`
+
+// ERC1155Abi 查询用到的 ERC-1155 方法
+const ERC1155Abi = `[
+	{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"account","type":"address"},{"name":"id","type":"uint256"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"type":"function","name":"balanceOfBatch","stateMutability":"view","inputs":[{"name":"accounts","type":"address[]"},{"name":"ids","type":"uint256[]"}],"outputs":[{"name":"","type":"uint256[]"}]},
+	{"type":"function","name":"uri","stateMutability":"view","inputs":[{"name":"id","type":"uint256"}],"outputs":[{"name":"","type":"string"}]}
+]`
+
+var (
+	erc721Abi, _  = tool.ParseABI(ERC721Abi)
+	erc1155Abi, _ = tool.ParseABI(ERC1155Abi)
+)
+
+// ERC-165 接口 id
+var (
+	erc165InterfaceId  = [4]byte{0x01, 0xff, 0xc9, 0xa7}
+	invalidInterfaceId = [4]byte{0xff, 0xff, 0xff, 0xff} // ERC-165 要求对该 id 返回 false
+	erc721InterfaceId  = [4]byte{0x80, 0xac, 0x58, 0xcd}
+	erc1155InterfaceId = [4]byte{0xd9, 0xb6, 0x7a, 0x26}
+)
+
+type TokenStandard string
+
+const (
+	StandardERC20   TokenStandard = "erc20"
+	StandardERC721  TokenStandard = "erc721"
+	StandardERC1155 TokenStandard = "erc1155"
+	StandardUnknown TokenStandard = "unknown" // 不是合约，或者不是以上任何一种代币
+)
+
+type NFTTokenRpcReq struct {
+	ContractAddress string   // 合约的以太坊地址
+	TokenId         *big.Int // NFT 的 id
+}
+
+type NFTBalanceRpcReq struct {
+	ContractAddress string   // 合约的以太坊地址
+	UserAddress     string   // 用户的以太坊地址
+	TokenId         *big.Int // ERC-1155 的 id，ERC-721 不需要
+}
+
+// DetectTokenStandards 通过 ERC-165 supportsInterface 判断合约是 ERC-721 还是 ERC-1155，
+// 都不是时按 decimals、totalSupply 是否有返回判断是不是 ERC-20。结果与 contracts 按下标一一对应，
+// 只缓存所有子调用都有确定结果（返回或者回滚）的合约
+func (r *ETHRPCRequester) DetectTokenStandards(contracts []string) ([]BatchResult[TokenStandard], error) {
+	return r.DetectTokenStandardsContext(context.Background(), contracts)
+}
+
+func (r *ETHRPCRequester) DetectTokenStandardsContext(ctx context.Context, contracts []string) ([]BatchResult[TokenStandard], error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	return r.detectTokenStandards(ctx, contracts)
+}
+
+func (r *ETHRPCRequester) detectTokenStandards(ctx context.Context, contracts []string) ([]BatchResult[TokenStandard], error) {
+	const callsPerContract = 6
+	finalRes := make([]BatchResult[TokenStandard], len(contracts))
+	var calls []tokenCall
+	var missing []common.Address // 需要查询的合约，每个对应 calls 中连续的 callsPerContract 个请求
+	pending := make(map[common.Address][]int)
+	for i, contract := range contracts {
+		if err := r.resolveAddressArgs(ctx, &contract); err != nil {
+			finalRes[i].Err = fmt.Errorf("invalid contract address %w", err)
+			continue
+		}
+		address := common.HexToAddress(contract)
+		r.tokens.lock.Lock()
+		standard, ok := r.tokens.standards[address]
+		r.tokens.lock.Unlock()
+		if ok {
+			finalRes[i].Value = standard
+			continue
+		}
+		if _, ok := pending[address]; !ok {
+			missing = append(missing, address)
+			for _, id := range [][4]byte{erc165InterfaceId, invalidInterfaceId, erc721InterfaceId, erc1155InterfaceId} {
+				data, _ := erc721Abi.Pack("supportsInterface", id)
+				calls = append(calls, tokenCall{to: address, data: data})
+			}
+			for _, method := range []string{"decimals", "totalSupply"} {
+				data, _ := erc20Abi.Pack(method)
+				calls = append(calls, tokenCall{to: address, data: data})
+			}
+		}
+		pending[address] = append(pending[address], i)
+	}
+	if len(calls) == 0 {
+		return finalRes, nil
+	}
+	results, err := r.batchTokenCall(ctx, calls, "latest")
+	if err != nil {
+		return nil, err
+	}
+	for j, address := range missing {
+		res := results[callsPerContract*j : callsPerContract*(j+1)]
+		if err := transientCallError(res); err != nil {
+			// 超时、限流、节点错误时不能判断，也不缓存，下次重新查询
+			for _, i := range pending[address] {
+				finalRes[i].Err = fmt.Errorf("detect token standard of %s failed %s", address.Hex(), err.Error())
+			}
+			continue
+		}
+		standard := StandardUnknown
+		erc165 := supportsInterface(res[0]) && !supportsInterface(res[1])
+		switch {
+		case erc165 && supportsInterface(res[2]):
+			standard = StandardERC721
+		case erc165 && supportsInterface(res[3]):
+			standard = StandardERC1155
+		case res[4].Err == nil && len(res[4].Value) >= 32 && res[5].Err == nil && len(res[5].Value) >= 32:
+			standard = StandardERC20
+		}
+		r.tokens.lock.Lock()
+		r.tokens.standards[address] = standard
+		r.tokens.lock.Unlock()
+		for _, i := range pending[address] {
+			finalRes[i].Value = standard
+		}
+	}
+	return finalRes, nil
+}
+
+// transientCallError 返回第一个不是合约回滚的错误。回滚说明合约确实没有实现该方法，结果可以缓存
+func transientCallError(results []BatchResult[hexutil.Bytes]) error {
+	for _, res := range results {
+		if res.Err == nil {
+			continue
+		}
+		var revertErr *ExecutionRevertedError
+		if !errors.As(decodeRevert(res.Err, ""), &revertErr) {
+			return res.Err
+		}
+	}
+	return nil
+}
+
+// supportsInterface 调用失败或者没有返回数据都视为不支持
+func supportsInterface(result BatchResult[hexutil.Bytes]) bool {
+	if result.Err != nil || len(result.Value) < 32 {
+		return false
+	}
+	values, err := erc721Abi.Unpack("supportsInterface", result.Value)
+	return err == nil && values[0].(bool)
+}
+
+// GetNFTOwners 批量查询 ERC-721 的 ownerOf
+func (r *ETHRPCRequester) GetNFTOwners(paramArr []NFTTokenRpcReq) ([]BatchResult[common.Address], error) {
+	return r.GetNFTOwnersContext(context.Background(), paramArr)
+}
+
+func (r *ETHRPCRequester) GetNFTOwnersContext(ctx context.Context, paramArr []NFTTokenRpcReq) ([]BatchResult[common.Address], error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	calls := make([]*tokenCall, len(paramArr))
+	for i, param := range paramArr {
+		if err := r.resolveAddressArgs(ctx, &param.ContractAddress); err != nil {
+			calls[i] = &tokenCall{err: err}
+			continue
+		}
+		if param.TokenId == nil {
+			continue
+		}
+		data, _ := erc721Abi.Pack("ownerOf", param.TokenId)
+		calls[i] = &tokenCall{to: common.HexToAddress(param.ContractAddress), data: data}
+	}
+	results, err := r.batchNFTCall(ctx, calls)
+	if err != nil {
+		return nil, err
+	}
+	return unpackNFTResults[common.Address](results, "ownerOf", erc721Abi.Unpack), nil
+}
+
+// GetERC721Balances 批量查询用户持有某个 ERC-721 合约的 NFT 数量
+func (r *ETHRPCRequester) GetERC721Balances(paramArr []NFTBalanceRpcReq) ([]BatchResult[*big.Int], error) {
+	return r.GetERC721BalancesContext(context.Background(), paramArr)
+}
+
+func (r *ETHRPCRequester) GetERC721BalancesContext(ctx context.Context, paramArr []NFTBalanceRpcReq) ([]BatchResult[*big.Int], error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	calls := make([]*tokenCall, len(paramArr))
+	for i, param := range paramArr {
+		if err := r.resolveAddressArgs(ctx, &param.ContractAddress, &param.UserAddress); err != nil {
+			calls[i] = &tokenCall{err: err}
+			continue
+		}
+		data, _ := erc721Abi.Pack("balanceOf", common.HexToAddress(param.UserAddress))
+		calls[i] = &tokenCall{to: common.HexToAddress(param.ContractAddress), data: data}
+	}
+	results, err := r.batchNFTCall(ctx, calls)
+	if err != nil {
+		return nil, err
+	}
+	return unpackNFTResults[*big.Int](results, "balanceOf", erc721Abi.Unpack), nil
+}
+
+// GetERC1155Balances 批量查询 ERC-1155 的 balanceOf(account, id)，不同合约可以混在一起
+func (r *ETHRPCRequester) GetERC1155Balances(paramArr []NFTBalanceRpcReq) ([]BatchResult[*big.Int], error) {
+	return r.GetERC1155BalancesContext(context.Background(), paramArr)
+}
+
+func (r *ETHRPCRequester) GetERC1155BalancesContext(ctx context.Context, paramArr []NFTBalanceRpcReq) ([]BatchResult[*big.Int], error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	calls := make([]*tokenCall, len(paramArr))
+	for i, param := range paramArr {
+		if err := r.resolveAddressArgs(ctx, &param.ContractAddress, &param.UserAddress); err != nil {
+			calls[i] = &tokenCall{err: err}
+			continue
+		}
+		if param.TokenId == nil {
+			continue
+		}
+		data, _ := erc1155Abi.Pack("balanceOf", common.HexToAddress(param.UserAddress), param.TokenId)
+		calls[i] = &tokenCall{to: common.HexToAddress(param.ContractAddress), data: data}
+	}
+	results, err := r.batchNFTCall(ctx, calls)
+	if err != nil {
+		return nil, err
+	}
+	return unpackNFTResults[*big.Int](results, "balanceOf", erc1155Abi.Unpack), nil
+}
+
+// GetERC1155BalanceOfBatch 调用同一个合约的 balanceOfBatch，accounts 和 ids 按下标一一对应
+func (r *ETHRPCRequester) GetERC1155BalanceOfBatch(contract string, accounts []string, ids []*big.Int) ([]*big.Int, error) {
+	return r.GetERC1155BalanceOfBatchContext(context.Background(), contract, accounts, ids)
+}
+
+func (r *ETHRPCRequester) GetERC1155BalanceOfBatchContext(ctx context.Context, contract string, accounts []string,
+	ids []*big.Int) ([]*big.Int, error) {
+	if len(accounts) != len(ids) {
+		return nil, fmt.Errorf("accounts and ids length mismatch %d %d", len(accounts), len(ids))
+	}
+	if err := r.resolveAddressArgs(ctx, &contract); err != nil {
+		return nil, err
+	}
+	addresses := make([]common.Address, len(accounts))
+	for i, account := range accounts {
+		if err := r.resolveAddressArgs(ctx, &account); err != nil {
+			return nil, err
+		}
+		addresses[i] = common.HexToAddress(account)
+	}
+	caller, err := r.NewContractCallerContext(ctx, contract, ERC1155Abi)
+	if err != nil {
+		return nil, err
+	}
+	var balances []*big.Int
+	if err := caller.Call(ctx, &balances, "balanceOfBatch", addresses, ids); err != nil {
+		return nil, err
+	}
+	return balances, nil
+}
+
+// GetTokenURIs 批量查询 NFT 的元数据地址，ERC-721 调用 tokenURI，ERC-1155 调用 uri 并替换其中的 {id}
+func (r *ETHRPCRequester) GetTokenURIs(paramArr []NFTTokenRpcReq) ([]BatchResult[string], error) {
+	return r.GetTokenURIsContext(context.Background(), paramArr)
+}
+
+func (r *ETHRPCRequester) GetTokenURIsContext(ctx context.Context, paramArr []NFTTokenRpcReq) ([]BatchResult[string], error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	contracts := make([]string, len(paramArr))
+	resolveErrs := make([]error, len(paramArr))
+	for i, param := range paramArr {
+		contracts[i] = param.ContractAddress
+		// 解析失败时传空地址，detectTokenStandards 不会再解析一次
+		if resolveErrs[i] = r.resolveAddressArgs(ctx, &contracts[i]); resolveErrs[i] != nil {
+			contracts[i] = ""
+		}
+	}
+	standards, err := r.detectTokenStandards(ctx, contracts)
+	if err != nil {
+		return nil, err
+	}
+	for i, err := range resolveErrs {
+		if err != nil {
+			standards[i].Err = err
+		}
+	}
+	calls := make([]*tokenCall, len(paramArr))
+	for i, param := range paramArr {
+		if standards[i].Err != nil || param.TokenId == nil {
+			continue
+		}
+		var data []byte
+		switch standards[i].Value {
+		case StandardERC721:
+			data, _ = erc721Abi.Pack("tokenURI", param.TokenId)
+		case StandardERC1155:
+			data, _ = erc1155Abi.Pack("uri", param.TokenId)
+		default:
+			continue
+		}
+		calls[i] = &tokenCall{to: common.HexToAddress(contracts[i]), data: data}
+	}
+	results, err := r.batchNFTCall(ctx, calls)
+	if err != nil {
+		return nil, err
+	}
+	finalRes := make([]BatchResult[string], len(paramArr))
+	for i, result := range results {
+		if standards[i].Err != nil {
+			finalRes[i].Err = standards[i].Err
+			continue
+		}
+		if calls[i] == nil && paramArr[i].TokenId != nil {
+			finalRes[i].Err = fmt.Errorf("contract %s is not an nft contract (%s)", paramArr[i].ContractAddress, standards[i].Value)
+			continue
+		}
+		method, unpack := "tokenURI", erc721Abi.Unpack
+		if standards[i].Value == StandardERC1155 {
+			method, unpack = "uri", erc1155Abi.Unpack
+		}
+		res := unpackNFTResults[string]([]BatchResult[hexutil.Bytes]{result}, method, unpack)[0]
+		if res.Err == nil && standards[i].Value == StandardERC1155 {
+			// EIP-1155：客户端把 {id} 替换成 64 位小写十六进制的 id
+			res.Value = strings.ReplaceAll(res.Value, "{id}", fmt.Sprintf("%064x", paramArr[i].TokenId))
+		}
+		finalRes[i] = res
+	}
+	return finalRes, nil
+}
+
+// batchNFTCall calls 中为 nil 的元素表示参数不合法，对应的结果直接返回错误
+func (r *ETHRPCRequester) batchNFTCall(ctx context.Context, calls []*tokenCall) ([]BatchResult[hexutil.Bytes], error) {
+	finalRes := make([]BatchResult[hexutil.Bytes], len(calls))
+	var valid []tokenCall
+	var indexes []int // valid 中每个请求对应 calls 的下标
+	for i, call := range calls {
+		if call == nil {
+			finalRes[i].Err = fmt.Errorf("invalid parameter in request %d", i)
+			continue
+		}
+		if call.err != nil {
+			finalRes[i].Err = call.err
+			continue
+		}
+		valid = append(valid, *call)
+		indexes = append(indexes, i)
+	}
+	if len(valid) == 0 {
+		return finalRes, nil
+	}
+	results, err := r.batchTokenCall(ctx, valid, "latest")
+	if err != nil {
+		return nil, err
+	}
+	for j, result := range results {
+		finalRes[indexes[j]] = result
+	}
+	return finalRes, nil
+}
+
+// unpackNFTResults 按方法的第一个返回值解析成 T
+func unpackNFTResults[T any](results []BatchResult[hexutil.Bytes], method string,
+	unpack func(string, []byte) ([]interface{}, error)) []BatchResult[T] {
+	finalRes := make([]BatchResult[T], len(results))
+	for i, result := range results {
+		if result.Err != nil {
+			finalRes[i].Err = result.Err
+			continue
+		}
+		if len(result.Value) == 0 {
+			// 地址不是合约，或者合约没有这个方法
+			finalRes[i].Err = fmt.Errorf("contract returned empty result for %s", method)
+			continue
+		}
+		values, err := unpack(method, result.Value)
+		if err != nil {
+			finalRes[i].Err = fmt.Errorf("unpack %s failed %s", method, err.Error())
+			continue
+		}
+		value, ok := values[0].(T)
+		if !ok {
+			finalRes[i].Err = fmt.Errorf("unexpected %s result type %T", method, values[0])
+			continue
+		}
+		finalRes[i].Value = value
+	}
+	return finalRes
+}
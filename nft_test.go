@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	erc721Token  = common.HexToAddress("0x2000000000000000000000000000000000000001")
+	erc1155Token = common.HexToAddress("0x2000000000000000000000000000000000000002")
+	nftOwner     = common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266")
+)
+
+// nftService erc721Token、erc1155Token 是 NFT 合约，其他地址交给 erc20Service
+type nftService struct {
+	erc20    *erc20Service
+	failures atomic.Int32 // 大于 0 时 erc721Token 的调用返回节点错误，用于模拟超时、限流
+}
+
+func (s *nftService) Call(arg map[string]interface{}, block interface{}) (hexutil.Bytes, error) {
+	to := common.HexToAddress(arg["to"].(string))
+	data := common.FromHex(arg["data"].(string))
+	if to == erc721Token && s.failures.Add(-1) >= 0 {
+		return nil, errors.New("upstream request timeout")
+	}
+	if to != erc721Token && to != erc1155Token {
+		return s.erc20.Call(arg, block)
+	}
+	contractAbi := erc721Abi
+	if to == erc1155Token {
+		contractAbi = erc1155Abi
+	}
+	if bytes.Equal(data[:4], erc721Abi.Methods["supportsInterface"].ID) {
+		id := data[4:8]
+		supported := bytes.Equal(id, erc165InterfaceId[:]) ||
+			(to == erc721Token && bytes.Equal(id, erc721InterfaceId[:])) ||
+			(to == erc1155Token && bytes.Equal(id, erc1155InterfaceId[:]))
+		return erc721Abi.Methods["supportsInterface"].Outputs.Pack(supported)
+	}
+	method, err := contractAbi.MethodById(data[:4])
+	if err != nil {
+		return hexutil.Bytes{}, nil
+	}
+	switch method.Name {
+	case "ownerOf":
+		return method.Outputs.Pack(nftOwner)
+	case "balanceOf":
+		return method.Outputs.Pack(big.NewInt(3))
+	case "tokenURI":
+		return method.Outputs.Pack("ipfs://token/1")
+	case "uri":
+		return method.Outputs.Pack("https://nft.example/{id}.json")
+	case "balanceOfBatch":
+		return method.Outputs.Pack([]*big.Int{big.NewInt(1), big.NewInt(2)})
+	}
+	return hexutil.Bytes{}, nil
+}
+
+func newNFTRequester(t *testing.T) *ETHRPCRequester {
+	return newFakeRequester(t, "eth", &nftService{erc20: &erc20Service{}}, nil)
+}
+
+func TestETHRPCRequester_DetectTokenStandards(t *testing.T) {
+	requester := newNFTRequester(t)
+	res, err := requester.DetectTokenStandards([]string{erc721Token.Hex(), erc1155Token.Hex(), standardToken.Hex(), bareToken.Hex(), "bad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []TokenStandard{StandardERC721, StandardERC1155, StandardERC20, StandardUnknown}
+	for i, standard := range expected {
+		if res[i].Err != nil || res[i].Value != standard {
+			t.Fatalf("contract %d: expected %s, got %s %v", i, standard, res[i].Value, res[i].Err)
+		}
+	}
+	if res[4].Err == nil {
+		t.Fatal("expected error for invalid address")
+	}
+}
+
+func TestETHRPCRequester_DetectTokenStandardsTransientError(t *testing.T) {
+	service := &nftService{erc20: &erc20Service{}}
+	service.failures.Store(1)
+	requester := newFakeRequester(t, "eth", service, nil)
+	res, err := requester.DetectTokenStandards([]string{erc721Token.Hex(), standardToken.Hex()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 节点错误返回给调用方，同一批中其他合约不受影响
+	if res[0].Err == nil || res[1].Err != nil || res[1].Value != StandardERC20 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	// 失败的结果没有被缓存
+	res, err = requester.DetectTokenStandards([]string{erc721Token.Hex()})
+	if err != nil || res[0].Err != nil || res[0].Value != StandardERC721 {
+		t.Fatalf("unexpected result %+v %v", res, err)
+	}
+}
+
+func TestETHRPCRequester_NFTQueries(t *testing.T) {
+	requester := newNFTRequester(t)
+	owners, err := requester.GetNFTOwners([]NFTTokenRpcReq{{ContractAddress: erc721Token.Hex(), TokenId: big.NewInt(1)}, {ContractAddress: erc721Token.Hex()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owners[0].Err != nil || owners[0].Value != nftOwner || owners[1].Err == nil {
+		t.Fatalf("unexpected owners %+v", owners)
+	}
+
+	balances, err := requester.GetERC1155Balances([]NFTBalanceRpcReq{{ContractAddress: erc1155Token.Hex(), UserAddress: nftOwner.Hex(), TokenId: big.NewInt(7)}})
+	if err != nil || balances[0].Err != nil || balances[0].Value.Int64() != 3 {
+		t.Fatalf("unexpected erc1155 balances %+v %v", balances, err)
+	}
+
+	batch, err := requester.GetERC1155BalanceOfBatch(erc1155Token.Hex(), []string{nftOwner.Hex(), nftOwner.Hex()}, []*big.Int{big.NewInt(1), big.NewInt(2)})
+	if err != nil || len(batch) != 2 || batch[1].Int64() != 2 {
+		t.Fatalf("unexpected balanceOfBatch %v %v", batch, err)
+	}
+
+	uris, err := requester.GetTokenURIs([]NFTTokenRpcReq{
+		{ContractAddress: erc721Token.Hex(), TokenId: big.NewInt(1)},
+		{ContractAddress: erc1155Token.Hex(), TokenId: big.NewInt(255)},
+		{ContractAddress: standardToken.Hex(), TokenId: big.NewInt(1)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uris[0].Value != "ipfs://token/1" {
+		t.Fatalf("unexpected tokenURI %+v", uris[0])
+	}
+	if uris[1].Value != "https://nft.example/00000000000000000000000000000000000000000000000000000000000000ff.json" {
+		t.Fatalf("unexpected uri %+v", uris[1])
+	}
+	if uris[2].Err == nil {
+		t.Fatal("expected error for erc20 contract")
+	}
+}
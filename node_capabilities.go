@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// 启动时探测的可选方法，探测参数都是开销很小的请求
+var optionalMethodProbes = map[string][]interface{}{
+	"eth_getBlockReceipts":     {"latest"},
+	"eth_feeHistory":           {"0x1", "latest", []int{}},
+	"eth_maxPriorityFeePerGas": {},
+	"eth_getProof":             {zeroAddress, []string{}, "latest"},
+	"debug_traceTransaction":   {zeroHash, map[string]string{"tracer": "callTracer"}},
+	"debug_traceBlockByNumber": {"0x0", map[string]string{"tracer": "callTracer"}},
+	"trace_block":              {"0x0"},
+	"trace_transaction":        {zeroHash},
+}
+
+const zeroAddress = "0x0000000000000000000000000000000000000000"
+const zeroHash = "0x0000000000000000000000000000000000000000000000000000000000000000"
+
+// archiveProbeDepth 非归档节点一般只保留最近 128 个区块的状态，读取这么多区块之前的余额可以区分归档节点
+const archiveProbeDepth = 10000
+
+// ArchiveStatus 节点是否能读取历史区块的状态
+type ArchiveStatus int
+
+const (
+	ArchiveUnknown     ArchiveStatus = iota // 链上的区块数不超过 archiveProbeDepth，无法区分是否为归档节点
+	ArchiveAvailable                        // 归档节点
+	ArchiveUnavailable                      // 只保留最近区块的状态
+)
+
+func (s ArchiveStatus) String() string {
+	switch s {
+	case ArchiveAvailable:
+		return "available"
+	case ArchiveUnavailable:
+		return "unavailable"
+	}
+	return "unknown"
+}
+
+// NodeCapabilities 节点的客户端版本和支持的可选方法
+type NodeCapabilities struct {
+	ClientVersion string
+	Methods       map[string]bool // 可选方法是否可用
+	ArchiveState  ArchiveStatus   // 是否能读取历史区块的状态
+	ProbedAt      time.Time
+}
+
+// SupportedMethods 按名称排序的可用方法
+func (c *NodeCapabilities) SupportedMethods() []string {
+	var methods []string
+	for method, ok := range c.Methods {
+		if ok {
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+type nodeCapabilities struct {
+	lock        sync.Mutex
+	caps        *NodeCapabilities
+	probed      map[string]bool // 还没有完整探测时，单独探测过的方法
+	unsupported map[string]bool // 实际调用时发现不可用的方法，重新探测也不会覆盖
+}
+
+// ProbeCapabilities 重新探测节点能力。使用多个节点时探测的是当前评分最好的节点，
+// 之后实际调用返回方法不存在时会再把该方法标记为不可用
+func (r *ETHRPCRequester) ProbeCapabilities(ctx context.Context) (*NodeCapabilities, error) {
+	// 探测请求不持有锁，探测完成后再替换结果
+	caps, err := r.probeCapabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.capabilities.lock.Lock()
+	defer r.capabilities.lock.Unlock()
+	r.capabilities.caps = caps
+	return r.capabilities.snapshot(), nil
+}
+
+// Capabilities 返回探测结果，还没有探测过时先探测
+func (r *ETHRPCRequester) Capabilities(ctx context.Context) (*NodeCapabilities, error) {
+	r.capabilities.lock.Lock()
+	if r.capabilities.caps != nil {
+		defer r.capabilities.lock.Unlock()
+		return r.capabilities.snapshot(), nil
+	}
+	r.capabilities.lock.Unlock()
+
+	caps, err := r.probeCapabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.capabilities.lock.Lock()
+	defer r.capabilities.lock.Unlock()
+	// 并发探测时保留先完成的结果
+	if r.capabilities.caps == nil {
+		r.capabilities.caps = caps
+	}
+	return r.capabilities.snapshot(), nil
+}
+
+func (r *ETHRPCRequester) probeCapabilities(ctx context.Context) (*NodeCapabilities, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	caps := &NodeCapabilities{Methods: make(map[string]bool), ProbedAt: time.Now()}
+	if err := r.client.CallContext(ctx, &caps.ClientVersion, "web3_clientVersion"); err != nil && !isMethodUnsupported(err) {
+		return nil, fmt.Errorf("probe node failed %s", err.Error())
+	}
+
+	var methods []string
+	for method := range optionalMethodProbes {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	var reqs []rpc.BatchElem
+	for _, method := range methods {
+		reqs = append(reqs, rpc.BatchElem{Method: method, Args: optionalMethodProbes[method], Result: new(interface{})})
+	}
+	latest := ""
+	reqs = append(reqs, rpc.BatchElem{Method: "eth_blockNumber", Result: &latest})
+	if err := r.client.BatchCallContext(ctx, reqs); err != nil {
+		return nil, fmt.Errorf("probe node failed %s", err.Error())
+	}
+	for i, method := range methods {
+		// 参数错误、交易不存在等说明方法本身是可用的
+		caps.Methods[method] = !isMethodUnsupported(reqs[i].Error)
+	}
+
+	// 链太短时任何节点都能读取最早的状态，无法区分
+	number, ok := new(big.Int).SetString(strings.TrimPrefix(latest, "0x"), 16)
+	if ok && number.Cmp(big.NewInt(archiveProbeDepth)) > 0 {
+		historical := new(big.Int).Sub(number, big.NewInt(archiveProbeDepth))
+		balance := ""
+		err := r.client.CallContext(ctx, &balance, "eth_getBalance", zeroAddress, fmt.Sprintf("%#x", historical))
+		caps.ArchiveState = ArchiveUnavailable
+		if err == nil {
+			caps.ArchiveState = ArchiveAvailable
+		}
+	}
+	return caps, nil
+}
+
+// supports 方法是否可用。已经完整探测过时使用探测结果，否则只单独探测这一个方法；
+// 探测失败时乐观地认为可用，由调用失败后的回退处理
+func (r *ETHRPCRequester) supports(ctx context.Context, method string) bool {
+	n := r.capabilities
+	n.lock.Lock()
+	if n.unsupported[method] {
+		n.lock.Unlock()
+		return false
+	}
+	var supported, probed bool
+	if n.caps != nil {
+		supported, probed = n.caps.Methods[method]
+	}
+	if !probed {
+		supported, probed = n.probed[method]
+	}
+	n.lock.Unlock()
+	if probed {
+		return supported
+	}
+	args, ok := optionalMethodProbes[method]
+	if !ok {
+		return true
+	}
+
+	// 探测请求不持有锁
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	err := r.client.CallContext(ctx, new(interface{}), method, args...)
+	// 网络错误、限流时不记录结果，下次调用重新探测
+	if err != nil && !isMethodUnsupported(err) && shouldFailover(err) {
+		return true
+	}
+	supported = !isMethodUnsupported(err)
+	n.lock.Lock()
+	n.probed[method] = supported
+	n.lock.Unlock()
+	return supported
+}
+
+// pickMethod 按优先级返回第一个可用的方法
+func (r *ETHRPCRequester) pickMethod(ctx context.Context, candidates ...string) (string, bool) {
+	for _, method := range candidates {
+		if r.supports(ctx, method) {
+			return method, true
+		}
+	}
+	return "", false
+}
+
+// markUnsupported 实际调用返回方法不存在时记录下来，后续直接走回退逻辑
+func (r *ETHRPCRequester) markUnsupported(method string, err error) {
+	if !isMethodUnsupported(err) {
+		return
+	}
+	r.capabilities.lock.Lock()
+	defer r.capabilities.lock.Unlock()
+	r.capabilities.unsupported[method] = true
+}
+
+func (n *nodeCapabilities) snapshot() *NodeCapabilities {
+	caps := *n.caps
+	caps.Methods = make(map[string]bool, len(n.caps.Methods))
+	for method, ok := range n.caps.Methods {
+		caps.Methods[method] = ok
+	}
+	for method := range n.unsupported {
+		caps.Methods[method] = false
+	}
+	return &caps
+}
+
+// isMethodUnsupported 方法不存在或者被节点禁用。只匹配方法级别的错误，
+// "header not available"、状态已被裁剪等数据不存在的错误说明方法本身可用
+func isMethodUnsupported(err error) bool {
+	if err == nil {
+		return false
+	}
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	switch rpcErr.ErrorCode() {
+	case -32601, -32004: // method not found, method not supported
+		return true
+	}
+	// 部分服务商使用其他错误码，只能按消息判断
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "method not found") ||
+		strings.Contains(msg, "method not supported") ||
+		strings.Contains(msg, "unsupported method") ||
+		strings.Contains(msg, "does not exist/is not available")
+}
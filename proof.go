@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"eth-relay/model"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// ErrProofInvalid 节点返回的账户或存储数据与 Merkle 证明不一致
+var ErrProofInvalid = errors.New("merkle proof verification failed")
+
+// VerifiedAccount 已经用区块的 stateRoot 验证过的账户状态
+type VerifiedAccount struct {
+	Address     common.Address
+	Balance     *big.Int
+	Nonce       uint64
+	CodeHash    common.Hash
+	StorageHash common.Hash
+	Storage     map[common.Hash]*big.Int // 存储槽 -> 值，不存在的槽为 0
+	StateRoot   common.Hash
+	Block       BlockRef
+}
+
+// GetProof 调用 eth_getProof 读取账户以及 storageKeys 对应存储槽的 Merkle 证明，不做验证
+func (r *ETHRPCRequester) GetProof(address string, storageKeys []string) (*model.AccountProof, error) {
+	return r.GetProofContext(context.Background(), address, storageKeys)
+}
+
+func (r *ETHRPCRequester) GetProofContext(ctx context.Context, address string, storageKeys []string) (*model.AccountProof, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	return r.getProof(ctx, address, storageKeys, "latest")
+}
+
+func (r *ETHRPCRequester) getProof(ctx context.Context, address string, storageKeys []string, block interface{}) (*model.AccountProof, error) {
+	if err := r.resolveAddressArgs(ctx, &address); err != nil {
+		return nil, err
+	}
+	if storageKeys == nil {
+		storageKeys = []string{}
+	}
+	proof := &model.AccountProof{}
+	if err := r.client.CallContext(ctx, proof, "eth_getProof", address, storageKeys, block); err != nil {
+		r.markUnsupported("eth_getProof", err)
+		return nil, err
+	}
+	return proof, nil
+}
+
+// GetVerifiedAccount 读取 latest 区块的账户证明，并在本地用该区块的 stateRoot 验证，
+// 不需要信任节点返回的余额、nonce、codeHash 和存储值
+func (r *ETHRPCRequester) GetVerifiedAccount(address string, storageKeys []string) (*VerifiedAccount, error) {
+	return r.GetVerifiedAccountAt(context.Background(), address, storageKeys, AtLatest)
+}
+
+func (r *ETHRPCRequester) GetVerifiedAccountContext(ctx context.Context, address string, storageKeys []string) (*VerifiedAccount, error) {
+	return r.GetVerifiedAccountAt(ctx, address, storageKeys, AtLatest)
+}
+
+// GetVerifiedAccountAt 区块头会在本地重新计算 hash，与选择的区块 hash 不一致时返回 ErrProofInvalid，
+// 所以节点无法伪造 stateRoot。但是按区块号或者标签选择时，区块 hash 本身也来自同一个节点，
+// 不信任节点时需要用 AtBlockHash 传入从可信来源（其他节点、轻客户端、已经确认过的记录）得到的区块 hash。
+// pending 区块没有确定的 stateRoot，不能验证
+func (r *ETHRPCRequester) GetVerifiedAccountAt(ctx context.Context, address string, storageKeys []string,
+	block BlockSelector) (*VerifiedAccount, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	if block.tag == "pending" {
+		return nil, fmt.Errorf("cannot verify proof against the pending block")
+	}
+	raw, ref, param, err := r.resolveBlockHeader(ctx, block)
+	if err != nil {
+		return nil, err
+	}
+	header, err := verifyHeader(raw, ref, block)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.resolveAddressArgs(ctx, &address); err != nil {
+		return nil, err
+	}
+	proof, err := r.getProof(ctx, address, storageKeys, param)
+	if err != nil {
+		return nil, err
+	}
+	account, err := VerifyAccountProof(proof, header.Root, address, storageKeys)
+	if err != nil {
+		return nil, err
+	}
+	account.Block = ref
+	return account, nil
+}
+
+// verifyHeader 用节点返回的字段重新构造区块头，keccak256(rlp(header)) 必须等于返回的 hash，
+// 按 hash 选择区块时还必须等于请求的 hash
+func verifyHeader(raw json.RawMessage, ref BlockRef, block BlockSelector) (*types.Header, error) {
+	header := &types.Header{}
+	if err := json.Unmarshal(raw, header); err != nil {
+		return nil, fmt.Errorf("%w: invalid block header %s", ErrProofInvalid, err.Error())
+	}
+	hash := header.Hash()
+	if hash != common.HexToHash(ref.Hash) {
+		return nil, fmt.Errorf("%w: block header hashes to %s but node returned %s", ErrProofInvalid, hash.Hex(), ref.Hash)
+	}
+	if block.hash != "" && hash != common.HexToHash(block.hash) {
+		return nil, fmt.Errorf("%w: node returned block %s for %s", ErrProofInvalid, hash.Hex(), block.hash)
+	}
+	return header, nil
+}
+
+// VerifyAccountProof 用 stateRoot 验证 eth_getProof 的返回，证明与返回的字段不一致，
+// 或者返回的账户、存储槽与请求的 address、storageKeys 不一致时返回 ErrProofInvalid
+func VerifyAccountProof(proof *model.AccountProof, stateRoot common.Hash, address string, storageKeys []string) (*VerifiedAccount, error) {
+	if !common.IsHexAddress(proof.Address) {
+		return nil, fmt.Errorf("%w: invalid address %q", ErrProofInvalid, proof.Address)
+	}
+	if !common.IsHexAddress(address) {
+		return nil, fmt.Errorf("invalid address %q", address)
+	}
+	if common.HexToAddress(proof.Address) != common.HexToAddress(address) {
+		return nil, fmt.Errorf("%w: node returned proof for %s but requested %s", ErrProofInvalid, proof.Address, address)
+	}
+	account := &VerifiedAccount{
+		Address:     common.HexToAddress(proof.Address),
+		CodeHash:    common.HexToHash(proof.CodeHash),
+		StorageHash: common.HexToHash(proof.StorageHash),
+		Storage:     make(map[common.Hash]*big.Int),
+		StateRoot:   stateRoot,
+	}
+	var err error
+	if account.Balance, err = hexutil.DecodeBig(proof.Balance); err != nil {
+		return nil, fmt.Errorf("%w: invalid balance %q", ErrProofInvalid, proof.Balance)
+	}
+	if account.Nonce, err = hexutil.DecodeUint64(proof.Nonce); err != nil {
+		return nil, fmt.Errorf("%w: invalid nonce %q", ErrProofInvalid, proof.Nonce)
+	}
+
+	value, err := verifyProof(stateRoot, crypto.Keccak256(account.Address.Bytes()), proof.AccountProof)
+	if err != nil {
+		return nil, fmt.Errorf("%w: account %s %s", ErrProofInvalid, account.Address.Hex(), err.Error())
+	}
+	if value == nil {
+		// 证明账户不存在，节点返回的必须是空账户
+		if account.Balance.Sign() != 0 || account.Nonce != 0 ||
+			!isEmptyHash(account.CodeHash, types.EmptyCodeHash) || !isEmptyHash(account.StorageHash, types.EmptyRootHash) {
+			return nil, fmt.Errorf("%w: account %s does not exist but node returned state", ErrProofInvalid, account.Address.Hex())
+		}
+		account.CodeHash, account.StorageHash = types.EmptyCodeHash, types.EmptyRootHash
+	} else {
+		stateAccount := types.StateAccount{}
+		if err := rlp.DecodeBytes(value, &stateAccount); err != nil {
+			return nil, fmt.Errorf("%w: invalid account rlp %s", ErrProofInvalid, err.Error())
+		}
+		if stateAccount.Balance.ToBig().Cmp(account.Balance) != 0 || stateAccount.Nonce != account.Nonce ||
+			!bytes.Equal(stateAccount.CodeHash, account.CodeHash.Bytes()) || stateAccount.Root != account.StorageHash {
+			return nil, fmt.Errorf("%w: account %s fields do not match the proof", ErrProofInvalid, account.Address.Hex())
+		}
+	}
+
+	// 返回的存储槽必须正好是请求的存储槽，不能多也不能少
+	requested := make(map[common.Hash]bool, len(storageKeys))
+	for _, key := range storageKeys {
+		requested[common.HexToHash(key)] = true
+	}
+	for _, storage := range proof.StorageProof {
+		slot := common.HexToHash(storage.Key)
+		if !requested[slot] {
+			return nil, fmt.Errorf("%w: node returned unrequested storage %s", ErrProofInvalid, slot.Hex())
+		}
+		// 部分节点返回补齐到 32 字节的值
+		claimed := common.HexToHash(storage.Value).Big()
+		value, err := verifyProof(account.StorageHash, crypto.Keccak256(slot.Bytes()), storage.Proof)
+		if err != nil {
+			return nil, fmt.Errorf("%w: storage %s %s", ErrProofInvalid, slot.Hex(), err.Error())
+		}
+		proven := new(big.Int)
+		if value != nil {
+			// 存储树中的值是去掉前导 0 的字节数组的 rlp 编码
+			content := []byte{}
+			if err := rlp.DecodeBytes(value, &content); err != nil {
+				return nil, fmt.Errorf("%w: invalid storage rlp %s", ErrProofInvalid, err.Error())
+			}
+			proven.SetBytes(content)
+		}
+		if proven.Cmp(claimed) != 0 {
+			return nil, fmt.Errorf("%w: storage %s is %s in the proof but node returned %s", ErrProofInvalid, slot.Hex(), proven, claimed)
+		}
+		account.Storage[slot] = proven
+	}
+	for slot := range requested {
+		if _, ok := account.Storage[slot]; !ok {
+			return nil, fmt.Errorf("%w: node did not return storage %s", ErrProofInvalid, slot.Hex())
+		}
+	}
+	return account, nil
+}
+
+// verifyProof 节点不存在时返回 nil
+func verifyProof(root common.Hash, key []byte, nodes []string) ([]byte, error) {
+	if root == types.EmptyRootHash && len(nodes) == 0 {
+		// 空树，比如没有存储的账户
+		return nil, nil
+	}
+	db := memorydb.New()
+	for _, node := range nodes {
+		data, err := hexutil.Decode(node)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proof node %q", node)
+		}
+		_ = db.Put(crypto.Keccak256(data), data)
+	}
+	return trie.VerifyProof(root, key, db)
+}
+
+// isEmptyHash 部分节点对不存在的账户返回全 0 的 hash
+func isEmptyHash(hash, empty common.Hash) bool {
+	return hash == empty || hash == common.Hash{}
+}
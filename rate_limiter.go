@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrBudgetExhausted = errors.New("rpc credit budget exhausted")
+
+type BudgetPeriod string
+
+const (
+	BudgetDaily   BudgetPeriod = "daily"
+	BudgetMonthly BudgetPeriod = "monthly"
+)
+
+// RateLimitOptions 额度只记录在内存中，每个进程单独计算，重启后当前周期的已用额度从 0 开始；
+// 多个进程共用同一个节点账号时需要自行分配 Budget
+type RateLimitOptions struct {
+	CreditsPerSecond float64            // 令牌桶每秒补充的额度
+	Burst            float64            // 令牌桶容量
+	MethodCosts      map[string]float64 // 每个方法消耗的额度
+	DefaultCost      float64            // 未在 MethodCosts 中配置的方法消耗的额度
+	Budget           float64            // 一个周期内的总额度，0 表示不限制
+	BudgetPeriod     BudgetPeriod       // 额度按天还是按月重置，按 UTC 计算
+}
+
+// RateLimiter 令牌桶限流 + 周期额度预算。额度不足时按调用顺序排队等待
+type RateLimiter struct {
+	options    *RateLimitOptions
+	lock       sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+	used       float64   // 当前周期已使用的额度
+	periodEnd  time.Time // 当前周期的结束时间
+}
+
+func NewRateLimiter(options *RateLimitOptions) *RateLimiter {
+	if options.DefaultCost == 0 {
+		options.DefaultCost = 1
+	}
+	if options.Burst == 0 {
+		options.Burst = options.CreditsPerSecond
+	}
+	now := time.Now()
+	return &RateLimiter{
+		options:    options,
+		lock:       sync.Mutex{},
+		tokens:     options.Burst,
+		lastRefill: now,
+		periodEnd:  nextPeriodStart(now, options.BudgetPeriod),
+	}
+}
+
+func (l *RateLimiter) Cost(method string) float64 {
+	if cost, ok := l.options.MethodCosts[method]; ok {
+		return cost
+	}
+	return l.options.DefaultCost
+}
+
+// Wait 先扣除额度再等待令牌补足，ctx 取消时退回额度
+func (l *RateLimiter) Wait(ctx context.Context, cost float64) error {
+	l.lock.Lock()
+	now := time.Now()
+	l.refillLocked(now)
+	if l.options.Budget > 0 && l.used+cost > l.options.Budget {
+		l.lock.Unlock()
+		return ErrBudgetExhausted
+	}
+	l.used += cost
+	wait := time.Duration(0)
+	if l.options.CreditsPerSecond > 0 {
+		l.tokens -= cost
+		if l.tokens < 0 {
+			wait = time.Duration(-l.tokens / l.options.CreditsPerSecond * float64(time.Second))
+		}
+	}
+	l.lock.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.refund(cost)
+		return ctx.Err()
+	}
+}
+
+// RemainingBudget 返回当前周期剩余的额度，没有配置预算时第二个返回值为 false
+func (l *RateLimiter) RemainingBudget() (float64, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.refillLocked(time.Now())
+	if l.options.Budget <= 0 {
+		return 0, false
+	}
+	return l.options.Budget - l.used, true
+}
+
+func (l *RateLimiter) refund(cost float64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.used -= cost
+	if l.options.CreditsPerSecond > 0 {
+		l.tokens += cost
+	}
+}
+
+func (l *RateLimiter) refillLocked(now time.Time) {
+	if l.options.CreditsPerSecond > 0 {
+		l.tokens += now.Sub(l.lastRefill).Seconds() * l.options.CreditsPerSecond
+		if l.tokens > l.options.Burst {
+			l.tokens = l.options.Burst
+		}
+	}
+	l.lastRefill = now
+	if !now.Before(l.periodEnd) {
+		l.used = 0
+		l.periodEnd = nextPeriodStart(now, l.options.BudgetPeriod)
+	}
+}
+
+func nextPeriodStart(now time.Time, period BudgetPeriod) time.Time {
+	now = now.UTC()
+	if period == BudgetMonthly {
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+// retryAfterTransport 记录 429 响应里的 Retry-After，go-ethereum 的 rpc.HTTPError 不包含响应头
+type retryAfterTransport struct {
+	base         http.RoundTripper
+	onRetryAfter func(d time.Duration)
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+	t.onRetryAfter(parseRetryAfter(resp.Header.Get("Retry-After")))
+	return resp, err
+}
+
+// parseRetryAfter Retry-After 可以是秒数，也可以是 HTTP 日期，缺省按 1 秒处理
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return time.Second
+}
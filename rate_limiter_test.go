@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Wait(t *testing.T) {
+	limiter := NewRateLimiter(&RateLimitOptions{
+		CreditsPerSecond: 10,
+		Burst:            10,
+		MethodCosts:      map[string]float64{"eth_getLogs": 5},
+		Budget:           16,
+	})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(context.Background(), limiter.Cost("eth_getLogs")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 桶容量 10，第三次调用需要等待 0.5 秒补充额度
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("expected to be throttled, elapsed %s", elapsed)
+	}
+	remaining, limited := limiter.RemainingBudget()
+	if !limited || remaining != 1 {
+		t.Fatalf("unexpected remaining budget %v", remaining)
+	}
+	if err := limiter.Wait(context.Background(), limiter.Cost("eth_call")); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Wait(context.Background(), limiter.Cost("eth_call")); err != ErrBudgetExhausted {
+		t.Fatalf("expected budget exhausted, got %v", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter("3"); d != 3*time.Second {
+		t.Fatalf("unexpected duration %s", d)
+	}
+	if d := parseRetryAfter(""); d != time.Second {
+		t.Fatalf("unexpected duration %s", d)
+	}
+}
+
+func TestETHRPCClient_EarliestResume(t *testing.T) {
+	client, err := NewETHRPCClientWithOptions(&ClientOptions{
+		NodeUrls: []string{newFakeNode(t, "eth", &headService{}).URL, newFakeNode(t, "eth", &headService{}).URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	// 没有收到过 429 的节点不参与计算
+	client.lock.Lock()
+	client.endpoints[1].pausedAt = time.Now().Add(time.Second)
+	client.lock.Unlock()
+	if wait := client.earliestResume(); wait <= 0 || wait > time.Second {
+		t.Fatalf("unexpected wait %s", wait)
+	}
+	// 暂停时间已经过去，不返回负数
+	client.lock.Lock()
+	client.endpoints[1].pausedAt = time.Now().Add(-time.Second)
+	client.lock.Unlock()
+	if wait := client.earliestResume(); wait != 0 {
+		t.Fatalf("unexpected wait %s", wait)
+	}
+}
+
+func TestETHRPCClient_RetryChargesBudget(t *testing.T) {
+	var requests atomic.Int32
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(httpServer.Close)
+	client, err := NewETHRPCClientWithOptions(&ClientOptions{
+		NodeUrls:           []string{httpServer.URL},
+		ReconnectBaseDelay: 50 * time.Millisecond,
+		RateLimit:          &RateLimitOptions{Budget: 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	start := time.Now()
+	// 每轮重试都扣除额度，第 4 次请求时额度不足
+	if err := client.Call(new(string), "eth_blockNumber"); err != ErrBudgetExhausted {
+		t.Fatalf("expected budget exhausted, got %v", err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Fatalf("expected 3 requests, got %d", n)
+	}
+	// Retry-After 为 0 时至少等待 ReconnectBaseDelay
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("expected backoff between retries, elapsed %s", elapsed)
+	}
+}
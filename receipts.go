@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"eth-relay/model"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func (r *ETHRPCRequester) GetTransactionReceipt(txHash string) (*model.Receipt, error) {
+	return r.GetTransactionReceiptContext(context.Background(), txHash)
+}
+
+func (r *ETHRPCRequester) GetTransactionReceiptContext(ctx context.Context, txHash string) (*model.Receipt, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	receipt := &model.Receipt{}
+	if r.cache != nil && r.cache.Get(receiptKey(txHash), receipt) {
+		return receipt, nil
+	}
+	err := r.client.CallContext(ctx, receipt, "eth_getTransactionReceipt", txHash)
+	if err != nil {
+		return nil, err
+	}
+	// 交易不存在或者还没有被打包时返回 null
+	if receipt.TransactionHash == "" {
+		return nil, fmt.Errorf("receipt of %s not found", txHash)
+	}
+	r.cacheReceipt(ctx, receipt)
+	return receipt, nil
+}
+
+// GetTransactionReceipts 批量查询交易收据，结果与 txHashArr 按下标一一对应
+func (r *ETHRPCRequester) GetTransactionReceipts(txHashArr []string) ([]BatchResult[*model.Receipt], error) {
+	return r.GetTransactionReceiptsContext(context.Background(), txHashArr)
+}
+
+func (r *ETHRPCRequester) GetTransactionReceiptsContext(ctx context.Context, txHashArr []string) ([]BatchResult[*model.Receipt], error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+	defer cancel()
+	name := "eth_getTransactionReceipt"
+	finalRes := make([]BatchResult[*model.Receipt], len(txHashArr))
+	var resArr []*model.Receipt
+	var reqs []rpc.BatchElem
+	var indexes []int // reqs 中每个请求对应 txHashArr 的下标
+	for i, txHash := range txHashArr {
+		res := model.Receipt{}
+		if r.cache != nil && r.cache.Get(receiptKey(txHash), &res) {
+			finalRes[i].Value = &res
+			continue
+		}
+		req := rpc.BatchElem{
+			Method: name,
+			Args:   []interface{}{txHash},
+			Result: &res,
+		}
+		reqs = append(reqs, req)
+		resArr = append(resArr, &res)
+		indexes = append(indexes, i)
+	}
+	if len(reqs) == 0 {
+		return finalRes, nil
+	}
+	err := r.client.BatchCallContext(ctx, reqs)
+	if err != nil {
+		return nil, err
+	}
+	for j, req := range reqs {
+		i := indexes[j]
+		switch {
+		case req.Error != nil:
+			finalRes[i].Err = req.Error
+		case resArr[j].TransactionHash == "":
+			finalRes[i].Err = fmt.Errorf("receipt of %s not found", txHashArr[i])
+		default:
+			finalRes[i].Value = resArr[j]
+			r.cacheReceipt(ctx, resArr[j])
+		}
+	}
+	return finalRes, nil
+}
+
+// GetBlockReceiptsByNumber 查询区块内所有交易的收据，按交易在区块中的顺序排列
+func (r *ETHRPCRequester) GetBlockReceiptsByNumber(blockNumber *big.Int) ([]*model.Receipt, error) {
+	return r.GetBlockReceiptsByNumberContext(context.Background(), blockNumber)
+}
+
+func (r *ETHRPCRequester) GetBlockReceiptsByNumberContext(ctx context.Context, blockNumber *big.Int) ([]*model.Receipt, error) {
+	return r.getBlockReceipts(ctx, fmt.Sprintf("%#x", blockNumber), func(ctx context.Context) (*model.FullBlock, error) {
+		return r.GetBlockInfoByNumberContext(ctx, blockNumber)
+	})
+}
+
+func (r *ETHRPCRequester) GetBlockReceiptsByHash(blockHash string) ([]*model.Receipt, error) {
+	return r.GetBlockReceiptsByHashContext(context.Background(), blockHash)
+}
+
+func (r *ETHRPCRequester) GetBlockReceiptsByHashContext(ctx context.Context, blockHash string) ([]*model.Receipt, error) {
+	var receipts []*model.Receipt
+	if r.cache != nil && r.cache.Get(blockReceiptsKey(blockHash), &receipts) {
+		return receipts, nil
+	}
+	return r.getBlockReceipts(ctx, blockHash, func(ctx context.Context) (*model.FullBlock, error) {
+		return r.GetBlockInfoByHashContext(ctx, blockHash)
+	})
+}
+
+// getBlockReceipts 节点支持 eth_getBlockReceipts 时一次取回，否则先查区块再批量查询每笔交易的收据
+func (r *ETHRPCRequester) getBlockReceipts(ctx context.Context, block string, getBlock func(ctx context.Context) (*model.FullBlock, error)) ([]*model.Receipt, error) {
+	name := "eth_getBlockReceipts"
+	if r.supports(ctx, name) {
+		readCtx, cancel := withDefaultTimeout(ctx, r.timeouts.BatchRead)
+		var receipts []*model.Receipt
+		err := r.client.CallContext(readCtx, &receipts, name, block)
+		cancel()
+		if err == nil {
+			if receipts == nil {
+				return nil, fmt.Errorf("block %s not found", block)
+			}
+			r.cacheBlockReceipts(ctx, receipts)
+			return receipts, nil
+		}
+		if !isMethodUnsupported(err) {
+			return nil, err
+		}
+		r.markUnsupported(name, err)
+	}
+
+	fullBlock, err := getBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	txHashArr := make([]string, len(fullBlock.Transactions))
+	for i, tx := range fullBlock.Transactions {
+		txHashArr[i] = tx.Hash
+	}
+	results, err := r.GetTransactionReceiptsContext(ctx, txHashArr)
+	if err != nil {
+		return nil, err
+	}
+	receipts := make([]*model.Receipt, len(results))
+	for i, res := range results {
+		if res.Err != nil {
+			return nil, fmt.Errorf("get receipt of %s failed %s", txHashArr[i], res.Err.Error())
+		}
+		// 查询区块和收据之间可能发生了回滚
+		if res.Value.BlockHash != fullBlock.Hash {
+			return nil, fmt.Errorf("receipt of %s belongs to block %s, expected %s", txHashArr[i], res.Value.BlockHash, fullBlock.Hash)
+		}
+		receipts[i] = res.Value
+	}
+	r.cacheBlockReceipts(ctx, receipts)
+	return receipts, nil
+}
+
+// cacheReceipt 只缓存已经被 finalized 区块打包的交易的收据
+func (r *ETHRPCRequester) cacheReceipt(ctx context.Context, receipt *model.Receipt) {
+	if r.cache == nil || receipt.BlockHash == "" || !r.isFinalized(ctx, receipt.BlockNumber) {
+		return
+	}
+	r.cache.Put(receiptKey(receipt.TransactionHash), receipt.BlockHash, receipt)
+}
+
+func (r *ETHRPCRequester) cacheBlockReceipts(ctx context.Context, receipts []*model.Receipt) {
+	if r.cache == nil || len(receipts) == 0 || !r.isFinalized(ctx, receipts[0].BlockNumber) {
+		return
+	}
+	r.cache.Put(blockReceiptsKey(receipts[0].BlockHash), receipts[0].BlockHash, receipts)
+}
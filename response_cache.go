@@ -0,0 +1,318 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type CacheOptions struct {
+	MaxEntries     int    // 内存中最多缓存的条目数
+	MaxBytes       int    // 内存中缓存数据的总字节数上限，0 表示不限制
+	DiskDir        string // 不为空时缓存同时写入该目录，重启后仍然有效
+	MaxDiskEntries int    // 磁盘上最多保存的条目数，超过时删除最久没有使用的文件，默认 100000
+}
+
+type CacheStats struct {
+	Hits        uint64
+	Misses      uint64
+	Entries     int
+	Bytes       int
+	DiskEntries int
+}
+
+type cacheEntry struct {
+	Key       string          `json:"key"`
+	BlockHash string          `json:"blockHash"` // 数据所属的区块，回滚时按区块失效
+	Data      json.RawMessage `json:"data"`
+}
+
+// ResponseCache 只缓存不会变化的链上数据：按 hash 查询的区块，以及已经 finalized 的区块中的交易和收据
+type ResponseCache struct {
+	options *CacheOptions
+	lock    sync.Mutex
+	lru     *list.List               // 最近使用的在前
+	entries map[string]*list.Element // key -> lru 节点
+	byBlock map[string][]string      // 区块 hash -> 属于该区块的 key
+	bytes   int
+	hits    uint64
+	misses  uint64
+	disk    *list.List               // 磁盘上的文件路径，最近使用的在前
+	files   map[string]*list.Element // 文件路径 -> disk 节点
+}
+
+func NewResponseCache(options *CacheOptions) *ResponseCache {
+	if options.MaxEntries == 0 {
+		options.MaxEntries = 10000
+	}
+	if options.MaxDiskEntries == 0 {
+		options.MaxDiskEntries = 100000
+	}
+	c := &ResponseCache{
+		options: options,
+		lock:    sync.Mutex{},
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		byBlock: make(map[string][]string),
+		disk:    list.New(),
+		files:   make(map[string]*list.Element),
+	}
+	if options.DiskDir != "" {
+		_ = os.MkdirAll(options.DiskDir, 0o755)
+		c.loadDiskIndex()
+	}
+	return c
+}
+
+// Get 命中时把数据反序列化到 value 中
+func (c *ResponseCache) Get(key string, value interface{}) bool {
+	c.lock.Lock()
+	elem, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(elem)
+		c.hits++
+		data := elem.Value.(*cacheEntry).Data
+		c.lock.Unlock()
+		return json.Unmarshal(data, value) == nil
+	}
+	c.lock.Unlock()
+
+	entry, ok := c.readDisk(key)
+	c.lock.Lock()
+	if !ok {
+		c.misses++
+		c.lock.Unlock()
+		return false
+	}
+	c.hits++
+	c.addLocked(entry)
+	c.lock.Unlock()
+	return json.Unmarshal(entry.Data, value) == nil
+}
+
+func (c *ResponseCache) Put(key, blockHash string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	entry := &cacheEntry{Key: key, BlockHash: blockHash, Data: data}
+	c.lock.Lock()
+	c.addLocked(entry)
+	c.lock.Unlock()
+	c.writeDisk(entry)
+}
+
+func (c *ResponseCache) Invalidate(key string) {
+	c.lock.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.removeLocked(elem)
+	}
+	c.lock.Unlock()
+	c.removeDisk(key)
+}
+
+// InvalidateBlock 区块回滚后，删除该区块以及属于该区块的所有缓存
+func (c *ResponseCache) InvalidateBlock(blockHash string) {
+	blockHash = strings.ToLower(blockHash)
+	c.lock.Lock()
+	keys := append([]string{}, c.byBlock[blockHash]...)
+	c.lock.Unlock()
+	// 只在磁盘上的交易不在 byBlock 索引中，通过缓存的区块找到它们
+	block := struct {
+		Transactions []struct {
+			Hash string `json:"hash"`
+		} `json:"transactions"`
+	}{}
+	if entry, ok := c.readDisk(blockKey(blockHash)); ok && json.Unmarshal(entry.Data, &block) == nil {
+		for _, tx := range block.Transactions {
+			keys = append(keys, txKey(tx.Hash), receiptKey(tx.Hash))
+		}
+	}
+	keys = append(keys, blockReceiptsKey(blockHash))
+	for _, key := range keys {
+		c.Invalidate(key)
+	}
+	c.Invalidate(blockKey(blockHash))
+}
+
+func (c *ResponseCache) Stats() CacheStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return CacheStats{
+		Hits:        c.hits,
+		Misses:      c.misses,
+		Entries:     c.lru.Len(),
+		Bytes:       c.bytes,
+		DiskEntries: c.disk.Len(),
+	}
+}
+
+func (c *ResponseCache) addLocked(entry *cacheEntry) {
+	if elem, ok := c.entries[entry.Key]; ok {
+		c.removeLocked(elem)
+	}
+	c.entries[entry.Key] = c.lru.PushFront(entry)
+	c.bytes += len(entry.Data)
+	if entry.BlockHash != "" {
+		blockHash := strings.ToLower(entry.BlockHash)
+		c.byBlock[blockHash] = append(c.byBlock[blockHash], entry.Key)
+	}
+	for c.lru.Len() > c.options.MaxEntries || (c.options.MaxBytes > 0 && c.bytes > c.options.MaxBytes && c.lru.Len() > 1) {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+func (c *ResponseCache) removeLocked(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, entry.Key)
+	c.bytes -= len(entry.Data)
+	if entry.BlockHash == "" {
+		return
+	}
+	blockHash := strings.ToLower(entry.BlockHash)
+	keys := c.byBlock[blockHash]
+	for i, key := range keys {
+		if key == entry.Key {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(keys) == 0 {
+		delete(c.byBlock, blockHash)
+	} else {
+		c.byBlock[blockHash] = keys
+	}
+}
+
+func (c *ResponseCache) diskPath(key string) string {
+	return filepath.Join(c.options.DiskDir, strings.ReplaceAll(key, ":", "_")+".json")
+}
+
+func (c *ResponseCache) readDisk(key string) (*cacheEntry, bool) {
+	if c.options.DiskDir == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.diskPath(key))
+	if err != nil {
+		return nil, false
+	}
+	entry := &cacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil || entry.Key != key {
+		return nil, false
+	}
+	c.lock.Lock()
+	if elem, ok := c.files[c.diskPath(key)]; ok {
+		c.disk.MoveToFront(elem)
+	}
+	c.lock.Unlock()
+	return entry, true
+}
+
+func (c *ResponseCache) writeDisk(entry *cacheEntry) {
+	if c.options.DiskDir == "" {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	// 先写临时文件再改名，避免进程退出时留下写了一半的文件
+	tmp := c.diskPath(entry.Key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return
+	}
+	path := c.diskPath(entry.Key)
+	if err := os.Rename(tmp, path); err != nil {
+		return
+	}
+	c.lock.Lock()
+	if elem, ok := c.files[path]; ok {
+		c.disk.MoveToFront(elem)
+	} else {
+		c.files[path] = c.disk.PushFront(path)
+	}
+	var evicted []string
+	for c.disk.Len() > c.options.MaxDiskEntries {
+		oldest := c.disk.Back()
+		c.disk.Remove(oldest)
+		delete(c.files, oldest.Value.(string))
+		evicted = append(evicted, oldest.Value.(string))
+	}
+	c.lock.Unlock()
+	for _, path := range evicted {
+		_ = os.Remove(path)
+	}
+}
+
+func (c *ResponseCache) removeDisk(key string) {
+	if c.options.DiskDir == "" {
+		return
+	}
+	path := c.diskPath(key)
+	c.lock.Lock()
+	if elem, ok := c.files[path]; ok {
+		c.disk.Remove(elem)
+		delete(c.files, path)
+	}
+	c.lock.Unlock()
+	_ = os.Remove(path)
+}
+
+// loadDiskIndex 启动时按修改时间建立磁盘文件的索引，超过 MaxDiskEntries 的旧文件直接删除
+func (c *ResponseCache) loadDiskIndex() {
+	dirEntries, err := os.ReadDir(c.options.DiskDir)
+	if err != nil {
+		return
+	}
+	type diskFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []diskFile
+	for _, dirEntry := range dirEntries {
+		if dirEntry.IsDir() || !strings.HasSuffix(dirEntry.Name(), ".json") {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, diskFile{filepath.Join(c.options.DiskDir, dirEntry.Name()), info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+	for i, file := range files {
+		if i >= c.options.MaxDiskEntries {
+			_ = os.Remove(file.path)
+			continue
+		}
+		c.files[file.path] = c.disk.PushBack(file.path)
+	}
+}
+
+func blockKey(blockHash string) string {
+	return "block:" + strings.ToLower(blockHash)
+}
+
+func txKey(txHash string) string {
+	return "tx:" + strings.ToLower(txHash)
+}
+
+func receiptKey(txHash string) string {
+	return "receipt:" + strings.ToLower(txHash)
+}
+
+func blockReceiptsKey(blockHash string) string {
+	return "receipts:" + strings.ToLower(blockHash)
+}
+
+func tokenKey(contract string) string {
+	return "token:" + strings.ToLower(contract)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"eth-relay/model"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestResponseCache_LRU(t *testing.T) {
+	cache := NewResponseCache(&CacheOptions{MaxEntries: 2})
+	cache.Put(txKey("0x01"), "0xaa", "tx1")
+	cache.Put(txKey("0x02"), "0xaa", "tx2")
+	value := ""
+	if !cache.Get(txKey("0x01"), &value) || value != "tx1" {
+		t.Fatalf("expected cache hit, got %q", value)
+	}
+	// 0x02 最久没有被访问，会被淘汰
+	cache.Put(txKey("0x03"), "0xbb", "tx3")
+	if cache.Get(txKey("0x02"), &value) {
+		t.Fatal("expected 0x02 to be evicted")
+	}
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestResponseCache_InvalidateBlock(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewResponseCache(&CacheOptions{DiskDir: dir})
+	cache.Put(blockKey("0xAA"), "", map[string]interface{}{
+		"hash":         "0xaa",
+		"transactions": []map[string]string{{"hash": "0x01"}},
+	})
+	cache.Put(txKey("0x01"), "0xaa", "tx1")
+	cache.Put(receiptKey("0x01"), "0xaa", "receipt1")
+
+	// 重新打开，只剩磁盘上的数据
+	cache = NewResponseCache(&CacheOptions{DiskDir: dir})
+	cache.InvalidateBlock("0xaa")
+	value := ""
+	if cache.Get(txKey("0x01"), &value) {
+		t.Fatal("expected tx of the invalidated block to be removed")
+	}
+	if cache.Get(receiptKey("0x01"), &value) {
+		t.Fatal("expected receipt of the invalidated block to be removed")
+	}
+	if cache.Get(blockKey("0xaa"), &map[string]interface{}{}) {
+		t.Fatal("expected block to be removed")
+	}
+}
+
+func TestResponseCache_MaxDiskEntries(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewResponseCache(&CacheOptions{DiskDir: dir, MaxDiskEntries: 2})
+	cache.Put(txKey("0x01"), "0xaa", "tx1")
+	cache.Put(txKey("0x02"), "0xaa", "tx2")
+	cache.Put(txKey("0x03"), "0xaa", "tx3")
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || cache.Stats().DiskEntries != 2 {
+		t.Fatalf("expected 2 files on disk, got %d", len(files))
+	}
+
+	// 重新打开后只剩磁盘上的数据，最早写入的 0x01 已经被删除
+	cache = NewResponseCache(&CacheOptions{DiskDir: dir, MaxDiskEntries: 2})
+	value := ""
+	if cache.Get(txKey("0x01"), &value) {
+		t.Fatal("expected 0x01 to be evicted from disk")
+	}
+	if !cache.Get(txKey("0x03"), &value) || value != "tx3" {
+		t.Fatalf("expected disk hit, got %q", value)
+	}
+}
+
+type finalizedService struct {
+	header *model.Header
+}
+
+func (s *finalizedService) GetBlockByNumber(tag string, full bool) (*model.Header, error) {
+	return s.header, nil
+}
+
+func TestFinalizedTracker_RetryAfterNull(t *testing.T) {
+	service := &finalizedService{}
+	requester := newFakeRequester(t, "eth", service, &ClientOptions{Cache: &CacheOptions{}})
+	ctx := context.Background()
+	// 还没有 finalized 区块时返回 null，不能当成不支持
+	if number := requester.finalizedNumber(ctx); number != nil || requester.finalized.unsupported {
+		t.Fatalf("unexpected finalized %v unsupported=%v", number, requester.finalized.unsupported)
+	}
+	service.header = &model.Header{Number: "0x10"}
+	if number := requester.finalizedNumber(ctx); number != nil {
+		t.Fatalf("expected no retry before the refresh interval, got %v", number)
+	}
+	requester.finalized.updatedAt = time.Now().Add(-finalizedRefreshInterval)
+	if number := requester.finalizedNumber(ctx); number == nil || number.Int64() != 0x10 {
+		t.Fatalf("unexpected finalized %v", number)
+	}
+	if !requester.isFinalized(ctx, "0xf") || requester.isFinalized(ctx, "0x11") {
+		t.Fatal("unexpected isFinalized")
+	}
+}
+
+func TestFinalizedTracker_TagRejected(t *testing.T) {
+	// 没有注册 eth_getBlockByNumber，节点返回 method not found
+	requester := newFakeRequester(t, "net", &headService{}, &ClientOptions{Cache: &CacheOptions{}})
+	if number := requester.finalizedNumber(context.Background()); number != nil || !requester.finalized.unsupported {
+		t.Fatalf("expected unsupported, got %v", number)
+	}
+}
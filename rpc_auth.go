@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// readJWTSecret 读取 geth --authrpc.jwtsecret 格式的密钥文件：32 字节的 hex 字符串
+func readJWTSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read jwt secret failed %s", err.Error())
+	}
+	secret, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(string(data)), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwt secret %s", err.Error())
+	}
+	if len(secret) != 32 {
+		return nil, fmt.Errorf("invalid jwt secret length %d, expect 32 bytes", len(secret))
+	}
+	return secret, nil
+}
+
+// newJWTAuth 每个 HTTP 请求都会重新签发 HS256 token，geth 只接受 iat 前后 60 秒内的 token
+func newJWTAuth(secret []byte) rpc.HTTPAuth {
+	return func(h http.Header) error {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+		claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"iat":%d}`, time.Now().Unix())))
+		payload := header + "." + claims
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(payload))
+		signature := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+		h.Set("Authorization", "Bearer "+payload+"."+signature)
+		return nil
+	}
+}
+
+// splitBasicAuth 把 url 中的 user:password 取出来放到 Authorization 头里，返回去掉账号信息的 url
+func splitBasicAuth(nodeUrl string) (string, http.Header) {
+	u, err := url.Parse(nodeUrl)
+	if err != nil || u.User == nil {
+		return nodeUrl, nil
+	}
+	password, _ := u.User.Password()
+	credential := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+	u.User = nil
+	headers := http.Header{}
+	headers.Set("Authorization", "Basic "+credential)
+	return u.String(), headers
+}
+
+// ParseHeaders 解析 "Key: Value" 格式的请求头，多个之间用 ; 分隔
+func ParseHeaders(value string) (http.Header, error) {
+	headers := http.Header{}
+	for _, item := range strings.Split(value, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid header %q", item)
+		}
+		headers.Add(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+	return headers, nil
+}
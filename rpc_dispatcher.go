@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// batchChunks 按 MaxBatchSize 切分批量请求，切片共享底层数组，各元素的 Result/Error 会直接写回原数组
+func (erc *ETHRPCClient) batchChunks(reqs []rpc.BatchElem) [][]rpc.BatchElem {
+	size := erc.options.MaxBatchSize
+	var chunks [][]rpc.BatchElem
+	for start := 0; start < len(reqs); start += size {
+		end := start + size
+		if end > len(reqs) {
+			end = len(reqs)
+		}
+		chunks = append(chunks, reqs[start:end])
+	}
+	return chunks
+}
+
+// dispatchBatch 切分后的批量请求并发发送，并发数不超过 BatchConcurrency。
+// 某个子批次失败时错误记录在该子批次的每个 BatchElem.Error 上，只有全部失败或者 ctx 取消时才返回错误
+func (erc *ETHRPCClient) dispatchBatch(ctx context.Context, reqs []rpc.BatchElem) error {
+	chunks := erc.batchChunks(reqs)
+	if len(chunks) <= 1 {
+		return erc.do(ctx, erc.batchCost(reqs), func(client *rpc.Client) error {
+			return client.BatchCallContext(ctx, reqs)
+		})
+	}
+	var (
+		wg        sync.WaitGroup
+		lock      sync.Mutex
+		firstErr  error
+		succeeded int
+		sem       = make(chan struct{}, erc.options.BatchConcurrency)
+	)
+	for i, chunk := range chunks {
+		// 调用方已经取消时不再发送剩下的子批次
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if err := ctx.Err(); err != nil {
+			for _, rest := range chunks[i:] {
+				setBatchError(rest, err)
+			}
+			break
+		}
+		wg.Add(1)
+		go func(chunk []rpc.BatchElem) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			err := erc.do(ctx, erc.batchCost(chunk), func(client *rpc.Client) error {
+				return client.BatchCallContext(ctx, chunk)
+			})
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				// 只影响这个子批次，其他子批次的结果仍然有效
+				setBatchError(chunk, err)
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			succeeded++
+		}(chunk)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if succeeded == 0 {
+		return firstErr
+	}
+	return nil
+}
+
+// setBatchError 整个子批次请求失败时，把错误记录到其中每个请求上
+func setBatchError(chunk []rpc.BatchElem, err error) {
+	for i := range chunk {
+		if chunk[i].Error == nil {
+			chunk[i].Error = err
+		}
+	}
+}
+
+type pendingCall struct {
+	method string
+	args   []interface{}
+	result json.RawMessage
+	err    error
+	done   chan struct{}
+}
+
+// callCoalescer 把 CoalesceWindow 时间窗口内并发发出的单个请求合并成一个批量请求
+type callCoalescer struct {
+	client     *ETHRPCClient
+	lock       sync.Mutex
+	pending    []*pendingCall
+	deadline   time.Time // 当前窗口内调用方最晚的 deadline，有调用方没有 deadline 时为零值
+	noLimit    bool
+	timer      *time.Timer
+	generation uint64 // 每开启一个窗口加一，过期窗口的定时器不会提前发送下一个窗口
+}
+
+func newCallCoalescer(client *ETHRPCClient) *callCoalescer {
+	return &callCoalescer{
+		client: client,
+		lock:   sync.Mutex{},
+	}
+}
+
+func (c *callCoalescer) call(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	call := &pendingCall{
+		method: method,
+		args:   args,
+		done:   make(chan struct{}),
+	}
+	c.lock.Lock()
+	if len(c.pending) == 0 {
+		c.deadline, c.noLimit = time.Time{}, false
+		c.generation++
+		generation := c.generation
+		c.timer = time.AfterFunc(c.client.options.CoalesceWindow, func() { c.flush(generation) })
+	}
+	c.pending = append(c.pending, call)
+	if deadline, ok := ctx.Deadline(); !ok {
+		c.noLimit = true
+	} else if deadline.After(c.deadline) {
+		c.deadline = deadline
+	}
+	full := len(c.pending) >= c.client.options.MaxBatchSize
+	generation := c.generation
+	c.lock.Unlock()
+	if full {
+		c.flush(generation)
+	}
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if call.err != nil {
+		return call.err
+	}
+	if result == nil {
+		return nil
+	}
+	// 在调用方的 goroutine 里反序列化，调用方因 ctx 提前返回后不会再被写入
+	return json.Unmarshal(call.result, result)
+}
+
+// flush 发送第 generation 个窗口内的请求，该窗口已经发送过时直接返回
+func (c *callCoalescer) flush(generation uint64) {
+	c.lock.Lock()
+	if generation != c.generation {
+		c.lock.Unlock()
+		return
+	}
+	calls := c.pending
+	deadline, noLimit := c.deadline, c.noLimit
+	c.pending = nil
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+	c.lock.Unlock()
+	if len(calls) == 0 {
+		return
+	}
+
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if !noLimit {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	}
+	defer cancel()
+
+	reqs := make([]rpc.BatchElem, len(calls))
+	for i, call := range calls {
+		reqs[i] = rpc.BatchElem{
+			Method: call.method,
+			Args:   call.args,
+			Result: &call.result,
+		}
+	}
+	err := c.client.do(ctx, c.client.batchCost(reqs), func(client *rpc.Client) error {
+		return client.BatchCallContext(ctx, reqs)
+	})
+	for i, call := range calls {
+		call.err = err
+		if err == nil {
+			call.err = reqs[i].Error
+		}
+		close(call.done)
+	}
+}
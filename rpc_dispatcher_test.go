@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type echoService struct{}
+
+func (s *echoService) Echo(n int) int {
+	return n
+}
+
+// newEchoServer 本地 rpc 服务，统计收到的 http 请求数和批量请求数
+func newEchoServer(t *testing.T) (*httptest.Server, *int32, *int32) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("test", &echoService{}); err != nil {
+		t.Fatal(err)
+	}
+	var requests, batches int32
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		atomic.AddInt32(&requests, 1)
+		if strings.HasPrefix(strings.TrimSpace(string(body)), "[") {
+			atomic.AddInt32(&batches, 1)
+		}
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+		server.ServeHTTP(w, r)
+	}))
+	t.Cleanup(httpServer.Close)
+	return httpServer, &requests, &batches
+}
+
+func TestETHRPCClient_BatchCallSplit(t *testing.T) {
+	httpServer, requests, _ := newEchoServer(t)
+	client, err := NewETHRPCClientWithOptions(&ClientOptions{
+		NodeUrls:     []string{httpServer.URL},
+		MaxBatchSize: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make([]int, 5)
+	reqs := make([]rpc.BatchElem, 5)
+	for i := range reqs {
+		reqs[i] = rpc.BatchElem{Method: "test_echo", Args: []interface{}{i}, Result: &results[i]}
+	}
+	if err := client.BatchCall(reqs); err != nil {
+		t.Fatal(err)
+	}
+	for i, req := range reqs {
+		if req.Error != nil || results[i] != i {
+			t.Fatalf("unexpected result %d: %d %v", i, results[i], req.Error)
+		}
+	}
+	if n := atomic.LoadInt32(requests); n != 3 {
+		t.Fatalf("expected 3 http requests, got %d", n)
+	}
+}
+
+func TestETHRPCClient_CoalesceCalls(t *testing.T) {
+	httpServer, requests, batches := newEchoServer(t)
+	client, err := NewETHRPCClientWithOptions(&ClientOptions{
+		NodeUrls:       []string{httpServer.URL},
+		CoalesceWindow: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res := 0
+			if err := client.CallContext(context.Background(), &res, "test_echo", i); err != nil || res != i {
+				t.Errorf("unexpected result %d: %d %v", i, res, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if atomic.LoadInt32(requests) != 1 || atomic.LoadInt32(batches) != 1 {
+		t.Fatalf("expected 1 batch request, got %d requests", atomic.LoadInt32(requests))
+	}
+}
+
+func TestCallCoalescer_StaleFlush(t *testing.T) {
+	httpServer, requests, _ := newEchoServer(t)
+	client, err := NewETHRPCClientWithOptions(&ClientOptions{
+		NodeUrls:       []string{httpServer.URL},
+		CoalesceWindow: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.coalescer
+	call := func(n int) chan error {
+		errCh := make(chan error, 1)
+		go func() {
+			res := 0
+			errCh <- client.CallContext(context.Background(), &res, "test_echo", n)
+		}()
+		// 等到请求进入窗口
+		for {
+			c.lock.Lock()
+			pending := len(c.pending)
+			c.lock.Unlock()
+			if pending == 1 {
+				return errCh
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	first := call(1)
+	c.lock.Lock()
+	stale := c.generation
+	c.lock.Unlock()
+	c.flush(stale)
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+
+	// 上一个窗口的定时器到期，不能把新窗口提前发送
+	second := call(2)
+	c.flush(stale)
+	c.lock.Lock()
+	pending, current := len(c.pending), c.generation
+	c.lock.Unlock()
+	if pending != 1 || atomic.LoadInt32(requests) != 1 {
+		t.Fatalf("stale flush sent the next window, pending %d", pending)
+	}
+	c.flush(current)
+	if err := <-second; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestETHRPCClient_BatchCallCanceled(t *testing.T) {
+	httpServer, requests, _ := newEchoServer(t)
+	client, err := NewETHRPCClientWithOptions(&ClientOptions{
+		NodeUrls:     []string{httpServer.URL},
+		MaxBatchSize: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reqs := make([]rpc.BatchElem, 5)
+	for i := range reqs {
+		reqs[i] = rpc.BatchElem{Method: "test_echo", Args: []interface{}{i}, Result: new(int)}
+	}
+	// 已经取消的 ctx 不会发出任何子批次
+	if err := client.BatchCallContext(ctx, reqs); err != context.Canceled || atomic.LoadInt32(requests) != 0 {
+		t.Fatalf("unexpected error %v, %d requests", err, atomic.LoadInt32(requests))
+	}
+}
+
+func TestETHRPCClient_BatchCallPartialFailure(t *testing.T) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("test", &echoService{}); err != nil {
+		t.Fatal(err)
+	}
+	// 包含 4 的子批次整体返回 http 错误
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "[4]") {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+		server.ServeHTTP(w, r)
+	}))
+	t.Cleanup(httpServer.Close)
+	client, err := NewETHRPCClientWithOptions(&ClientOptions{
+		NodeUrls:     []string{httpServer.URL},
+		MaxBatchSize: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make([]int, 5)
+	reqs := make([]rpc.BatchElem, 5)
+	for i := range reqs {
+		reqs[i] = rpc.BatchElem{Method: "test_echo", Args: []interface{}{i}, Result: &results[i]}
+	}
+	if err := client.BatchCall(reqs); err != nil {
+		t.Fatal(err)
+	}
+	for i, req := range reqs {
+		if i < 4 && (req.Error != nil || results[i] != i) {
+			t.Fatalf("unexpected result %d: %d %v", i, results[i], req.Error)
+		}
+	}
+	if reqs[4].Error == nil {
+		t.Fatal("expected error on the failed chunk")
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrFixtureNotFound 回放时没有录制过该请求。不是传输层错误，不会导致节点被断开
+var ErrFixtureNotFound = errors.New("no fixture recorded for request")
+
+type FixtureMode string
+
+const (
+	FixtureRecord FixtureMode = "record" // 请求真实节点，并把请求和响应保存到文件
+	FixtureReplay FixtureMode = "replay" // 只从文件回放，不访问网络
+)
+
+// FixtureOptions 录制/回放只支持 http(s) 节点
+type FixtureOptions struct {
+	Mode FixtureMode
+	Path string // fixture 文件路径
+}
+
+type fixtureInteraction struct {
+	Request  json.RawMessage `json:"request"`  // 去掉 id 之后的请求
+	Response json.RawMessage `json:"response"` // 去掉 id 之后的响应，批量请求已按请求顺序排列
+}
+
+// FixtureStore 保存录制的 rpc 请求和响应。相同的请求按录制的顺序依次回放，用完之后重复使用最后一个
+type FixtureStore struct {
+	options      *FixtureOptions
+	lock         sync.Mutex
+	interactions []*fixtureInteraction
+	used         map[int]bool
+}
+
+func NewFixtureStore(options *FixtureOptions) (*FixtureStore, error) {
+	store := &FixtureStore{
+		options: options,
+		lock:    sync.Mutex{},
+		used:    make(map[int]bool),
+	}
+	if options.Mode == FixtureRecord {
+		return store, nil
+	}
+	data, err := os.ReadFile(options.Path)
+	if err != nil {
+		return nil, fmt.Errorf("read fixture failed %s", err.Error())
+	}
+	if err := json.Unmarshal(data, &store.interactions); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %s", options.Path, err.Error())
+	}
+	// 文件是缩进格式，压缩之后才能和请求逐字节比较
+	for _, item := range store.interactions {
+		buf := &bytes.Buffer{}
+		if err := json.Compact(buf, item.Request); err != nil {
+			return nil, err
+		}
+		item.Request = buf.Bytes()
+	}
+	return store, nil
+}
+
+func (s *FixtureStore) transport(base http.RoundTripper) http.RoundTripper {
+	return &fixtureTransport{store: s, base: base}
+}
+
+func (s *FixtureStore) record(request, response json.RawMessage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.interactions = append(s.interactions, &fixtureInteraction{Request: request, Response: response})
+	data, err := json.MarshalIndent(s.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.options.Path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(s.options.Path, data, 0o644)
+}
+
+func (s *FixtureStore) replay(request json.RawMessage) (json.RawMessage, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	last := -1
+	for i, item := range s.interactions {
+		if !bytes.Equal(item.Request, request) {
+			continue
+		}
+		if !s.used[i] {
+			s.used[i] = true
+			return item.Response, true
+		}
+		last = i
+	}
+	if last < 0 {
+		return nil, false
+	}
+	return s.interactions[last].Response, true
+}
+
+type fixtureTransport struct {
+	store *FixtureStore
+	base  http.RoundTripper
+}
+
+func (t *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = req.Body.Close()
+	request, ids, err := stripIds(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.store.options.Mode == FixtureReplay {
+		response, ok := t.store.replay(request)
+		if !ok {
+			return nil, fmt.Errorf("%w %s", ErrFixtureNotFound, string(request))
+		}
+		data, err := restoreIds(response, ids)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Status:     "200 OK",
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader(data)),
+			Request:    req,
+		}, nil
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response, err := sortAndStripIds(data, ids)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.store.record(request, response); err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return resp, nil
+}
+
+// stripIds 去掉 jsonrpc 消息中自增的 id，返回去掉 id 后的消息以及原来的 id 列表
+func stripIds(body []byte) (json.RawMessage, []json.RawMessage, error) {
+	msgs, batch, err := splitMessages(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]json.RawMessage, len(msgs))
+	for i, msg := range msgs {
+		ids[i] = msg["id"]
+		delete(msg, "id")
+	}
+	data, err := joinMessages(msgs, batch)
+	return data, ids, err
+}
+
+// sortAndStripIds 批量响应的顺序不一定和请求一致，按请求的 id 顺序重新排列后去掉 id
+func sortAndStripIds(body []byte, ids []json.RawMessage) (json.RawMessage, error) {
+	msgs, batch, err := splitMessages(body)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[string]map[string]json.RawMessage, len(msgs))
+	for _, msg := range msgs {
+		byId[string(msg["id"])] = msg
+		delete(msg, "id")
+	}
+	sorted := make([]map[string]json.RawMessage, 0, len(ids))
+	for _, id := range ids {
+		msg, ok := byId[string(id)]
+		if !ok {
+			return nil, errors.New("missing response in batch")
+		}
+		sorted = append(sorted, msg)
+	}
+	return joinMessages(sorted, batch)
+}
+
+func restoreIds(body []byte, ids []json.RawMessage) ([]byte, error) {
+	msgs, batch, err := splitMessages(body)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) != len(ids) {
+		return nil, errors.New("fixture response does not match the request")
+	}
+	for i, msg := range msgs {
+		msg["id"] = ids[i]
+	}
+	return joinMessages(msgs, batch)
+}
+
+func splitMessages(body []byte) ([]map[string]json.RawMessage, bool, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var msgs []map[string]json.RawMessage
+		err := json.Unmarshal(body, &msgs)
+		return msgs, true, err
+	}
+	msg := map[string]json.RawMessage{}
+	err := json.Unmarshal(body, &msg)
+	return []map[string]json.RawMessage{msg}, false, err
+}
+
+func joinMessages(msgs []map[string]json.RawMessage, batch bool) (json.RawMessage, error) {
+	if batch {
+		return json.Marshal(msgs)
+	}
+	return json.Marshal(msgs[0])
+}
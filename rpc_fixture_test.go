@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func echoAll(t *testing.T, client *ETHRPCClient) {
+	result := 0
+	if err := client.Call(&result, "test_echo", 7); err != nil || result != 7 {
+		t.Fatalf("unexpected call result %d %v", result, err)
+	}
+	results := make([]int, 3)
+	reqs := make([]rpc.BatchElem, 3)
+	for i := range reqs {
+		reqs[i] = rpc.BatchElem{Method: "test_echo", Args: []interface{}{i}, Result: &results[i]}
+	}
+	if err := client.BatchCall(reqs); err != nil {
+		t.Fatal(err)
+	}
+	for i, req := range reqs {
+		if req.Error != nil || results[i] != i {
+			t.Fatalf("unexpected result %d: %d %v", i, results[i], req.Error)
+		}
+	}
+}
+
+func TestFixtureStore_RecordReplay(t *testing.T) {
+	httpServer, requests, _ := newEchoServer(t)
+	path := filepath.Join(t.TempDir(), "fixture.json")
+
+	recorder, err := NewETHRPCClientWithOptions(&ClientOptions{
+		NodeUrls: []string{httpServer.URL},
+		Fixture:  &FixtureOptions{Mode: FixtureRecord, Path: path},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	echoAll(t, recorder)
+	recorded := atomic.LoadInt32(requests)
+	httpServer.Close()
+
+	player, err := NewETHRPCClientWithOptions(&ClientOptions{
+		NodeUrls: []string{httpServer.URL},
+		Fixture:  &FixtureOptions{Mode: FixtureReplay, Path: path},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	echoAll(t, player)
+	if n := atomic.LoadInt32(requests); n != recorded {
+		t.Fatalf("replay reached the server: %d requests, recorded %d", n, recorded)
+	}
+
+	// 没有录制的请求返回 ErrFixtureNotFound，节点不会被断开，之后的请求照常回放
+	result := 0
+	for i := 0; i < 2; i++ {
+		if err := player.Call(&result, "test_echo", 8); !errors.Is(err, ErrFixtureNotFound) {
+			t.Fatalf("expected ErrFixtureNotFound, got %v", err)
+		}
+	}
+	echoAll(t, player)
+}
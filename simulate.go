@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"eth-relay/tool"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	errorSelector = []byte{0x08, 0xc3, 0x79, 0xa0} // Error(string)
+	panicSelector = []byte{0x4e, 0x48, 0x7b, 0x71} // Panic(uint256)
+)
+
+// panicReasons solidity Panic(uint256) 错误码的含义
+var panicReasons = map[uint64]string{
+	0x00: "generic panic",
+	0x01: "assert(false)",
+	0x11: "arithmetic underflow or overflow",
+	0x12: "division or modulo by zero",
+	0x21: "enum overflow",
+	0x22: "invalid encoded storage byte array accessed",
+	0x31: "popping on an empty array",
+	0x32: "out-of-bounds access of an array or bytesN",
+	0x41: "out of memory",
+	0x51: "uninitialized function",
+}
+
+type RevertKind string
+
+const (
+	RevertReason  RevertKind = "reason"  // require/revert("reason")，即 Error(string)
+	RevertPanic   RevertKind = "panic"   // assert、溢出、除零等
+	RevertCustom  RevertKind = "custom"  // 合约 ABI 中定义的自定义错误
+	RevertUnknown RevertKind = "unknown" // 没有返回数据或者无法解析
+)
+
+// ExecutionRevertedError 预执行时交易会被回滚，Data 为原始的回滚数据
+type ExecutionRevertedError struct {
+	Kind      RevertKind
+	Reason    string        // Error(string) 的内容，或者 panic、自定义错误的可读描述
+	PanicCode *big.Int      // Kind 为 RevertPanic 时有效
+	ErrorName string        // Kind 为 RevertCustom 时的错误名
+	Args      []interface{} // Kind 为 RevertCustom 时的错误参数
+	Data      string
+}
+
+func (e *ExecutionRevertedError) Error() string {
+	if e.Reason == "" {
+		return "execution reverted"
+	}
+	return "execution reverted: " + e.Reason
+}
+
+type SimulationOptions struct {
+	Disabled  bool    // 为 true 时 SendTransaction 签名前不预执行，默认开启
+	GasMargin float64 // 在 eth_estimateGas 结果上增加的比例，默认 0.2
+	ErrorAbi  string  // 解析自定义错误使用的 ABI，可以只包含 error 定义
+}
+
+// SimulateTransaction 签名之前用 eth_call 和 eth_estimateGas 预执行交易。
+// 会回滚时返回 *ExecutionRevertedError，否则返回加上安全余量之后的 gas limit。
+// contractAbi 用来解析自定义错误，为空时使用 SimulationOptions.ErrorAbi
+func (r *ETHRPCRequester) SimulateTransaction(from string, transaction *types.Transaction, contractAbi string) (uint64, error) {
+	return r.SimulateTransactionContext(context.Background(), from, transaction, contractAbi)
+}
+
+func (r *ETHRPCRequester) SimulateTransactionContext(ctx context.Context, from string, transaction *types.Transaction,
+	contractAbi string) (uint64, error) {
+	ctx, cancel := withDefaultTimeout(ctx, r.timeouts.Read)
+	defer cancel()
+	if err := r.resolveAddressArgs(ctx, &from); err != nil {
+		return 0, err
+	}
+	if contractAbi == "" {
+		contractAbi = r.simulation.ErrorAbi
+	}
+	arg := simulationArg(from, transaction)
+	result := ""
+	if err := r.client.CallContext(ctx, &result, "eth_call", arg, "latest"); err != nil {
+		return 0, decodeRevert(err, contractAbi)
+	}
+	// 让节点自己搜索需要的 gas
+	delete(arg, "gas")
+	estimated := ""
+	if err := r.client.CallContext(ctx, &estimated, "eth_estimateGas", arg); err != nil {
+		return 0, decodeRevert(err, contractAbi)
+	}
+	gas, err := hexutil.DecodeUint64(estimated)
+	if err != nil {
+		return 0, fmt.Errorf("invalid gas estimate %s", estimated)
+	}
+	return gas + uint64(float64(gas)*r.simulation.GasMargin), nil
+}
+
+// simulationArg 和交易完全一致的调用参数
+func simulationArg(from string, transaction *types.Transaction) map[string]interface{} {
+	arg := map[string]interface{}{
+		"from":  from,
+		"value": (*hexutil.Big)(transaction.Value()),
+		"input": hexutil.Bytes(transaction.Data()),
+		"nonce": hexutil.Uint64(transaction.Nonce()),
+	}
+	if transaction.To() != nil {
+		arg["to"] = transaction.To()
+	}
+	if transaction.Gas() > 0 {
+		arg["gas"] = hexutil.Uint64(transaction.Gas())
+	}
+	if transaction.Type() == types.LegacyTxType || transaction.Type() == types.AccessListTxType {
+		arg["gasPrice"] = (*hexutil.Big)(transaction.GasPrice())
+	} else {
+		arg["maxFeePerGas"] = (*hexutil.Big)(transaction.GasFeeCap())
+		arg["maxPriorityFeePerGas"] = (*hexutil.Big)(transaction.GasTipCap())
+	}
+	if len(transaction.AccessList()) > 0 {
+		arg["accessList"] = transaction.AccessList()
+	}
+	return arg
+}
+
+// decodeRevert 节点返回回滚数据时解析成 *ExecutionRevertedError，其他错误原样返回
+func decodeRevert(err error, contractAbi string) error {
+	var dataErr rpc.DataError
+	data := ""
+	if errors.As(err, &dataErr) {
+		data, _ = dataErr.ErrorData().(string)
+	}
+	if data == "" || data == "0x" {
+		if !strings.Contains(err.Error(), "execution reverted") {
+			return err
+		}
+		// 部分节点只在 message 中返回原因
+		reason := strings.TrimPrefix(strings.TrimPrefix(err.Error(), "execution reverted"), ": ")
+		kind := RevertReason
+		if reason == "" {
+			kind = RevertUnknown
+		}
+		return &ExecutionRevertedError{Kind: kind, Reason: reason, Data: data}
+	}
+	raw, decodeErr := hexutil.Decode(data)
+	if decodeErr != nil {
+		return err
+	}
+	return DecodeRevertData(raw, contractAbi)
+}
+
+// DecodeRevertData 解析回滚数据：Error(string)、Panic(uint256)，或者 contractAbi 中定义的自定义错误
+func DecodeRevertData(data []byte, contractAbi string) *ExecutionRevertedError {
+	res := &ExecutionRevertedError{Kind: RevertUnknown, Data: hexutil.Encode(data)}
+	if len(data) < 4 {
+		return res
+	}
+	switch {
+	case bytes.Equal(data[:4], errorSelector):
+		if reason, err := abi.UnpackRevert(data); err == nil {
+			res.Kind = RevertReason
+			res.Reason = reason
+		}
+	case bytes.Equal(data[:4], panicSelector):
+		if len(data) >= 36 {
+			res.Kind = RevertPanic
+			res.PanicCode = new(big.Int).SetBytes(data[4:36])
+			reason, ok := panicReasons[res.PanicCode.Uint64()]
+			if !ok || !res.PanicCode.IsUint64() {
+				reason = "unknown panic"
+			}
+			res.Reason = fmt.Sprintf("panic %#x (%s)", res.PanicCode, reason)
+		}
+	case contractAbi != "":
+		_abi, err := tool.ParseABI(contractAbi)
+		if err != nil {
+			return res
+		}
+		customErr, err := _abi.ErrorByID([4]byte(data[:4]))
+		if err != nil {
+			return res
+		}
+		args, err := customErr.Inputs.Unpack(data[4:])
+		if err != nil {
+			return res
+		}
+		res.Kind = RevertCustom
+		res.ErrorName = customErr.Name
+		res.Args = args
+		var parts []string
+		for _, arg := range args {
+			if address, ok := arg.(common.Address); ok {
+				parts = append(parts, address.Hex())
+				continue
+			}
+			parts = append(parts, fmt.Sprint(arg))
+		}
+		res.Reason = fmt.Sprintf("%s(%s)", customErr.Name, strings.Join(parts, ", "))
+	}
+	return res
+}
+
+// withGasLimit 交易签名前替换 gas limit
+func withGasLimit(transaction *types.Transaction, gas uint64) (*types.Transaction, error) {
+	switch transaction.Type() {
+	case types.LegacyTxType:
+		return types.NewTx(&types.LegacyTx{
+			Nonce:    transaction.Nonce(),
+			GasPrice: transaction.GasPrice(),
+			Gas:      gas,
+			To:       transaction.To(),
+			Value:    transaction.Value(),
+			Data:     transaction.Data(),
+		}), nil
+	case types.AccessListTxType:
+		return types.NewTx(&types.AccessListTx{
+			ChainID:    transaction.ChainId(),
+			Nonce:      transaction.Nonce(),
+			GasPrice:   transaction.GasPrice(),
+			Gas:        gas,
+			To:         transaction.To(),
+			Value:      transaction.Value(),
+			Data:       transaction.Data(),
+			AccessList: transaction.AccessList(),
+		}), nil
+	case types.DynamicFeeTxType:
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    transaction.ChainId(),
+			Nonce:      transaction.Nonce(),
+			GasTipCap:  transaction.GasTipCap(),
+			GasFeeCap:  transaction.GasFeeCap(),
+			Gas:        gas,
+			To:         transaction.To(),
+			Value:      transaction.Value(),
+			Data:       transaction.Data(),
+			AccessList: transaction.AccessList(),
+		}), nil
+	}
+	return nil, fmt.Errorf("unsupported transaction type %d", transaction.Type())
+}
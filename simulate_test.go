@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestDecodeRevertData(t *testing.T) {
+	// Panic(0x11)
+	panicData := common.FromHex("0x4e487b71" + "0000000000000000000000000000000000000000000000000000000000000011")
+	res := DecodeRevertData(panicData, "")
+	if res.Kind != RevertPanic || res.PanicCode.Int64() != 0x11 {
+		t.Fatalf("unexpected panic %+v", res)
+	}
+	if res.Error() != "execution reverted: panic 0x11 (arithmetic underflow or overflow)" {
+		t.Fatalf("unexpected message %s", res.Error())
+	}
+
+	// InsufficientBalance(uint256 available, uint256 required)
+	errorAbi := `[{"type":"error","name":"InsufficientBalance","inputs":[` +
+		`{"name":"available","type":"uint256"},{"name":"required","type":"uint256"}]}]`
+	customData := common.FromHex("0xcf479181" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"0000000000000000000000000000000000000000000000000000000000000002")
+	res = DecodeRevertData(customData, errorAbi)
+	if res.Kind != RevertCustom || res.ErrorName != "InsufficientBalance" || len(res.Args) != 2 {
+		t.Fatalf("unexpected custom error %+v", res)
+	}
+	if res.Reason != "InsufficientBalance(1, 2)" {
+		t.Fatalf("unexpected reason %s", res.Reason)
+	}
+
+	// 没有 ABI 时无法解析自定义错误
+	res = DecodeRevertData(customData, "")
+	if res.Kind != RevertUnknown || res.Data == "" {
+		t.Fatalf("expected unknown revert, got %+v", res)
+	}
+}
+
+// revertingService eth_call 总是回滚，记录收到的广播请求数
+type revertingService struct {
+	sent atomic.Int64
+}
+
+func (s *revertingService) Call(arg map[string]interface{}, block interface{}) (hexutil.Bytes, error) {
+	return nil, &revertError{data: "0x"}
+}
+
+func (s *revertingService) ChainId() hexutil.Uint64 {
+	return 1
+}
+
+func (s *revertingService) SendRawTransaction(data hexutil.Bytes) (common.Hash, error) {
+	s.sent.Add(1)
+	return common.Hash{}, nil
+}
+
+func TestETHRPCRequester_SendTransactionSimulates(t *testing.T) {
+	service := &revertingService{}
+	requester := newFakeRequester(t, "eth", service, nil)
+	to := common.HexToAddress("0x6dB7d7A2B4b1Ee0c1E3d8D1b2F1B4C8F1E5A0259")
+	transaction := types.NewTransaction(0, to, big.NewInt(1), 21000, big.NewInt(1), nil)
+	// 默认预执行，会回滚的交易不广播
+	_, err := requester.SendTransaction("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266", transaction)
+	var revert *ExecutionRevertedError
+	if !errors.As(err, &revert) || service.sent.Load() != 0 {
+		t.Fatalf("expected revert without broadcast, got %v, sent %d", err, service.sent.Load())
+	}
+}
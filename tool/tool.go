@@ -17,9 +17,18 @@ import (
 var ETHUnlockMap map[string]accounts.Account
 var UnlockKs *keystore.KeyStore
 
-func MakeMethodId(methodName string, abiStr string) (string, error) {
+// ParseABI 解析合约 ABI 的 json 字符串
+func ParseABI(abiStr string) (*abi.ABI, error) {
 	_abi := &abi.ABI{}
 	err := _abi.UnmarshalJSON([]byte(abiStr))
+	if err != nil {
+		return nil, err
+	}
+	return _abi, nil
+}
+
+func MakeMethodId(methodName string, abiStr string) (string, error) {
+	_abi, err := ParseABI(abiStr)
 	if err != nil {
 		return "", err
 	}
@@ -64,7 +73,8 @@ func ExportKeystore(keysDir, privateKeyHex, password string) error {
 	return nil
 }
 
-func SignETHTransaction(address string, transaction *types.Transaction) (*types.Transaction, error) {
+// SignETHTransaction chainId 为 nil 时使用不带重放保护的 Homestead 签名
+func SignETHTransaction(address string, transaction *types.Transaction, chainId *big.Int) (*types.Transaction, error) {
 	if UnlockKs == nil {
 		return nil, errors.New("you need to init keystore first")
 	}
@@ -72,7 +82,7 @@ func SignETHTransaction(address string, transaction *types.Transaction) (*types.
 	if !common.IsHexAddress(account.Address.String()) {
 		return nil, errors.New("account need to unlock first")
 	}
-	return UnlockKs.SignTx(account, transaction, nil) // 调用签名函数
+	return UnlockKs.SignTx(account, transaction, chainId) // 调用签名函数
 }
 
 func GetRealDecimalValue(value string, decimal int) string {
@@ -91,6 +101,27 @@ func GetRealDecimalValue(value string, decimal int) string {
 	}
 }
 
+// FormatDecimalValue GetRealDecimalValue 的逆操作，把最小单位的整数转成带小数点的字符串，去掉末尾的 0
+func FormatDecimalValue(value *big.Int, decimal int) string {
+	if decimal <= 0 {
+		return value.String()
+	}
+	sign := ""
+	digits := value.String()
+	if value.Sign() < 0 {
+		sign = "-"
+		digits = digits[1:]
+	}
+	if len(digits) <= decimal {
+		digits = strings.Repeat("0", decimal-len(digits)+1) + digits
+	}
+	integer, fraction := digits[:len(digits)-decimal], strings.TrimRight(digits[len(digits)-decimal:], "0")
+	if fraction == "" {
+		return sign + integer
+	}
+	return sign + integer + "." + fraction
+}
+
 func BuildERC20TransferData(value, receiver string, decimal int) string {
 	realValue := GetRealDecimalValue(value, decimal)
 	valueBig, _ := new(big.Int).SetString(realValue, 10)
@@ -363,7 +363,7 @@ func TestUnlockETHWallet(t *testing.T) {
 		Data:     []byte("交易"),
 	}
 	tx := types.NewTx(&txData)
-	signTx, err := SignETHTransaction(address, tx)
+	signTx, err := SignETHTransaction(address, tx, big.NewInt(11155111))
 	if err != nil {
 		panic(err)
 	}
@@ -377,6 +377,16 @@ func TestGetRealDecimalValue(t *testing.T) {
 	fmt.Println(new(big.Int).SetString(value, 10))
 }
 
+func TestFormatDecimalValue(t *testing.T) {
+	cases := map[string]string{"1234500": "12345", "5": "0.05", "0": "0", "-150": "-1.5"}
+	for raw, expected := range cases {
+		value, _ := new(big.Int).SetString(raw, 10)
+		if res := FormatDecimalValue(value, 2); res != expected {
+			t.Fatalf("format %s: expected %s, got %s", raw, expected, res)
+		}
+	}
+}
+
 func TestExportKeystore(t *testing.T) {
 	privateKeyHex := "ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80"
 	password := "12345678"